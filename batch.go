@@ -0,0 +1,218 @@
+package main
+
+import (
+	"github.com/rfizzle/collector-helpers/outputs"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"os"
+	"time"
+)
+
+// batch tracks the events written to the current temp file and decides when it should be
+// shipped to the outputs.
+type batch struct {
+	schedule  time.Duration
+	maxEvents int
+	maxBytes  int64
+	count     int
+	bytes     int64
+	timestamp time.Time
+}
+
+// newBatch creates a batch that is shipped every schedule seconds, or earlier once maxEvents or
+// maxBytes is reached (0 disables the limit).
+func newBatch(schedule, maxEvents int, maxBytes int64) *batch {
+	return &batch{
+		schedule:  time.Duration(schedule) * time.Second,
+		maxEvents: maxEvents,
+		maxBytes:  maxBytes,
+		timestamp: time.Now(),
+	}
+}
+
+// add records an event of the supplied size in the batch
+func (b *batch) add(size int) {
+	b.count += 1
+	b.bytes += int64(size)
+}
+
+// full returns true when the batch has reached one of its limits
+func (b *batch) full() bool {
+	if b.maxEvents > 0 && b.count >= b.maxEvents {
+		return true
+	}
+
+	return b.maxBytes > 0 && b.bytes >= b.maxBytes
+}
+
+// expired returns true when the schedule has elapsed since the batch was started
+func (b *batch) expired() bool {
+	return !time.Now().Before(b.timestamp.Add(b.schedule))
+}
+
+// reset starts a new empty batch
+func (b *batch) reset() {
+	b.count = 0
+	b.bytes = 0
+	b.timestamp = time.Now()
+}
+
+// sink is a batch of events written to a temp file and shipped to a set of outputs. The output
+// params are the global ones overridden by the listener's outputs, if any.
+type sink struct {
+	tmpWriter *outputs.TmpWriter
+	batch     *batch
+	outputs   map[string]interface{}
+	unsent    []unsentBatch
+}
+
+// unsentBatch is a rotated temp file that failed to ship to the outputs and is retried on the next
+// rotation
+type unsentBatch struct {
+	path      string
+	count     int
+	timestamp string
+}
+
+// newSink creates a sink with its own temp file
+func newSink(schedule int, outputParams map[string]interface{}) (*sink, error) {
+	tmpWriter, err := outputs.NewTmpWriter()
+	if err != nil {
+		return nil, err
+	}
+
+	return &sink{
+		tmpWriter: tmpWriter,
+		batch:     newBatch(schedule, viper.GetInt("max-batch-events"), viper.GetInt64("max-batch-bytes")),
+		outputs:   outputParams,
+	}, nil
+}
+
+// writeToOutputs ships the temp file of the sink to its outputs
+func (s *sink) writeToOutputs(path string, timestamp string) error {
+	return withOutputParams(s.outputs, func() error {
+		return outputs.WriteToOutputs(path, timestamp)
+	})
+}
+
+// shipUnsent retries the batches that failed to ship. Batches that fail again are kept for the next
+// rotation.
+func (s *sink) shipUnsent() {
+	unsent := make([]unsentBatch, 0)
+
+	for _, u := range s.unsent {
+		if err := s.writeToOutputs(u.path, u.timestamp); err != nil {
+			log.Errorf("unable to write %v events to output (temporary file kept: %s): %v", u.count, u.path, err)
+			unsent = append(unsent, u)
+			continue
+		}
+
+		log.Infof("%v events processed...", u.count)
+
+		// Remove temp file now
+		if err := os.Remove(u.path); err != nil {
+			log.Errorf("unable to remove tmp file: %v", err)
+		}
+	}
+
+	s.unsent = unsent
+}
+
+// rotateBatch rotates the temp file and ships the batch, along with any pending dead-letters and
+// batches that failed to ship before, to the outputs. Empty batches are not rotated. The temp file is
+// only removed once it has been written successfully, otherwise it is retried on the next rotation.
+func rotateBatch(s *sink, deadLetters *deadLetterWriter) {
+	tmpWriter, b := s.tmpWriter, s.batch
+
+	// Write dead-letters to outputs
+	if err := deadLetters.Flush(b.timestamp.Format(time.RFC3339)); err != nil {
+		log.Errorf("%v", err)
+	}
+
+	// Retry batches that failed to ship
+	s.shipUnsent()
+
+	if b.count == 0 {
+		b.reset()
+		return
+	}
+
+	// Rotate temp file
+	if err := tmpWriter.Rotate(); err != nil {
+		log.Errorf("unable to rotate tmp file: %v", err)
+		return
+	}
+
+	// Print verbose
+	if viper.GetBool("verbose") {
+		log.Debugf("temporary log file written to: %v", tmpWriter.LastFilePath)
+	}
+
+	// Write to outputs
+	timestamp := b.timestamp.Format(time.RFC3339)
+	if err := s.writeToOutputs(tmpWriter.LastFilePath, timestamp); err != nil {
+		log.Errorf("unable to write to output: %v", err)
+		log.Errorf("temporary file kept: %s", tmpWriter.LastFilePath)
+		s.unsent = append(s.unsent, unsentBatch{path: tmpWriter.LastFilePath, count: b.count, timestamp: timestamp})
+		b.reset()
+		return
+	}
+
+	// Let know that event has been processes
+	log.Infof("%v events processed...", b.count)
+
+	// Update limit count
+	b.reset()
+
+	// Remove temp file now
+	if err := os.Remove(tmpWriter.LastFilePath); err != nil {
+		log.Errorf("unable to remove tmp file: %v", err)
+	}
+}
+
+// flushFinalBatch closes the temp file and ships the remaining batch, along with any pending
+// dead-letters and batches that failed to ship before, to the outputs. The temp files are only
+// removed once they have been written successfully.
+func flushFinalBatch(s *sink, deadLetters *deadLetterWriter) {
+	tmpWriter, b := s.tmpWriter, s.batch
+
+	// Close the temp file
+	log.Debugf("closing temp file...")
+	if err := tmpWriter.Close(); err != nil {
+		log.Errorf("error closing log file: %v", err)
+	}
+
+	// Retry batches that failed to ship
+	s.shipUnsent()
+	for _, u := range s.unsent {
+		log.Errorf("%v events not shipped, temporary file kept: %s", u.count, u.path)
+	}
+
+	// Write to outputs
+	shipped := true
+	if b.count > 0 {
+		log.Debugf("writing final batch to outputs...")
+		if err := s.writeToOutputs(tmpWriter.LastFilePath, b.timestamp.Format(time.RFC3339)); err != nil {
+			log.Errorf("unable to write final batch to output: %v", err)
+			log.Errorf("temporary file kept: %s", tmpWriter.LastFilePath)
+			shipped = false
+		} else {
+			log.Infof("%v events processed...", b.count)
+		}
+	}
+
+	// Write dead-letters to outputs
+	if err := deadLetters.Flush(b.timestamp.Format(time.RFC3339)); err != nil {
+		log.Errorf("%v", err)
+	}
+
+	if !shipped {
+		return
+	}
+
+	// Remove temp file now
+	log.Debugf("removing temp file...")
+	if err := os.Remove(tmpWriter.LastFilePath); err != nil {
+		log.Errorf("unable to remove tmp file: %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBatchFull(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxEvents int
+		maxBytes  int64
+		sizes     []int
+		expected  bool
+	}{
+		{"limits disabled", 0, 0, []int{100, 100, 100}, false},
+		{"below event limit", 3, 0, []int{10, 10}, false},
+		{"event limit reached", 3, 0, []int{10, 10, 10}, true},
+		{"below byte limit", 0, 100, []int{50, 49}, false},
+		{"byte limit reached", 0, 100, []int{50, 50}, true},
+		{"byte limit exceeded", 0, 100, []int{150}, true},
+		{"byte limit before event limit", 10, 100, []int{60, 60}, true},
+		{"event limit before byte limit", 2, 1000, []int{60, 60}, true},
+		{"empty batch", 1, 1, []int{}, false},
+	}
+
+	for _, test := range tests {
+		b := newBatch(30, test.maxEvents, test.maxBytes)
+		for _, size := range test.sizes {
+			b.add(size)
+		}
+
+		if full := b.full(); full != test.expected {
+			t.Errorf("%s: b.full() got %v; expected %v", test.name, full, test.expected)
+		}
+	}
+}
+
+func TestBatchExpired(t *testing.T) {
+	tests := []struct {
+		name     string
+		started  time.Duration
+		expected bool
+	}{
+		{"just started", 0, false},
+		{"before schedule", 29 * time.Second, false},
+		{"at schedule", 30 * time.Second, true},
+		{"after schedule", time.Minute, true},
+	}
+
+	for _, test := range tests {
+		b := newBatch(30, 0, 0)
+		b.timestamp = time.Now().Add(-test.started)
+
+		if expired := b.expired(); expired != test.expected {
+			t.Errorf("%s: b.expired() got %v; expected %v", test.name, expired, test.expected)
+		}
+	}
+}
+
+func TestBatchReset(t *testing.T) {
+	b := newBatch(30, 2, 100)
+	b.timestamp = time.Now().Add(-time.Minute)
+	b.add(60)
+	b.add(60)
+
+	if !b.full() || !b.expired() {
+		t.Fatalf("b.full() and b.expired() got %v, %v; expected true", b.full(), b.expired())
+	}
+
+	b.reset()
+
+	if b.count != 0 || b.bytes != 0 {
+		t.Errorf("b.count and b.bytes got %d, %d; expected 0", b.count, b.bytes)
+	}
+
+	if b.full() || b.expired() {
+		t.Errorf("b.full() and b.expired() got %v, %v; expected a new batch", b.full(), b.expired())
+	}
+}
+
+func TestSinkShipUnsent(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	dir, err := ioutil.TempDir("", "syslog-collector")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "batch.log")
+	if err := ioutil.WriteFile(path, []byte("{\"message\":\"a\"}\n"), 0644); err != nil {
+		t.Fatalf("failed to write batch file: %v", err)
+	}
+
+	// Output to a directory that does not exist
+	s := &sink{
+		outputs: map[string]interface{}{"file": true, "file-path": filepath.Join(dir, "missing", "out.log")},
+		unsent:  []unsentBatch{{path: path, count: 1, timestamp: "2020-10-17T10:00:00Z"}},
+	}
+
+	s.shipUnsent()
+
+	if len(s.unsent) != 1 {
+		t.Fatalf("s.unsent got %d batches; expected the failed batch to be kept", len(s.unsent))
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("failed to keep batch file that was not shipped: %v", err)
+	}
+
+	// Retry once the output works
+	s.outputs["file-path"] = filepath.Join(dir, "out.log")
+	s.shipUnsent()
+
+	if len(s.unsent) != 0 {
+		t.Errorf("s.unsent got %d batches; expected the batch to be shipped", len(s.unsent))
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("failed to remove shipped batch file: %v", err)
+	}
+
+	if content, _ := ioutil.ReadFile(filepath.Join(dir, "out.log")); string(content) != "{\"message\":\"a\"}\n" {
+		t.Errorf("output got %q; expected the batch", content)
+	}
+}
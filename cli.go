@@ -2,8 +2,10 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"github.com/rfizzle/collector-helpers/config"
 	"github.com/rfizzle/collector-helpers/outputs"
+	"github.com/rfizzle/syslog-collector/parser"
 	flag "github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"net"
@@ -17,13 +19,47 @@ func setupCliFlags() error {
 
 	config.InitCLIParams()
 	flag.Int("schedule", 30, "time in seconds to collect")
+	flag.Int("max-batch-events", 0, "ship the batch early once it holds this many events (0 to disable)")
+	flag.Int64("max-batch-bytes", 0, "ship the batch early once it holds this many bytes (0 to disable)")
+	flag.Int("shutdown-timeout", 30, "time in seconds to wait for the listeners to stop and then for the final batch to be written on shutdown")
 	flag.String("ip", "", "ip address to listen on")
 	flag.Int("port", 1514, "port to listen on")
-	flag.String("protocol", "udp", "protocol to use (tcp, udp, both)")
-	flag.String("parser", "raw", "parser to use for syslog messages (grok, json, kv, cef, raw)")
+	flag.String("protocol", "udp", "protocol to use (tcp, udp, both, tls, relp, unix, unixgram)")
+	flag.String("socket-path", "", "path of the unix socket to listen on (e.g. /dev/log)")
+	flag.String("socket-mode", "0666", "file mode of the unix socket (octal)")
+	flag.String("tcp-framing", "auto", "framing of TCP and TLS messages (auto, newline, octet-counting, delimiter)")
+	flag.String("tcp-frame-delimiter", "\\0", "delimiter between TCP frames when tcp-framing is delimiter (\\0 for NUL)")
+	flag.String("tls-cert", "", "path to the tls certificate (PEM)")
+	flag.String("tls-key", "", "path to the tls private key (PEM)")
+	flag.String("tls-ca", "", "path to the CA bundle used to verify client certificates (PEM)")
+	flag.Bool("tls-client-auth", false, "require clients to present a certificate signed by the tls CA")
+	flag.String("parser", "raw", fmt.Sprintf("comma separated parsers to try in order for syslog messages (%s)", strings.Join(parser.Names(), ", ")))
 	flag.StringArray("grok-pattern", []string{}, "grok pattern to parse logs to")
+	flag.String("grok-patterns-dir", "", "directory of grok pattern definition files (NAME regex)")
+	flag.StringArray("grok-pattern-file", []string{}, "grok pattern definition file (NAME regex)")
+	flag.StringArray("grok-field-type", []string{}, "type to convert a grok capture to (field=int|float|bool|string)")
+	flag.StringArray("regex-pattern", []string{}, "regular expression with named groups to parse logs with")
+	flag.String("json-prefix-field", "prefix", "field to keep the text before an embedded JSON object in")
+	flag.Bool("json-decode-nested", false, "decode JSON objects and arrays nested in JSON string fields")
+	flag.String("xml-prefix-field", "prefix", "field to keep the text before an XML document in")
+	flag.Bool("xml-windows-event", false, "flatten Windows event EventData/Data Name pairs into a keyed object")
+	flag.Bool("cef-expand-keys", false, "map CEF extension keys to their full dictionary names and collapse label pairs")
+	flag.Bool("cef-string-values", false, "keep CEF severity and extension values as strings instead of converting them to their data types")
+	flag.String("kv-pair-separator", " ", "separator between KV pairs")
+	flag.String("kv-value-separator", "=", "separator between a KV key and its value")
+	flag.String("kv-quotes", `"`, "characters that quote KV keys and values")
+	flag.Bool("kv-trim", false, "trim whitespace around KV keys and values")
+	flag.String("kv-duplicate-keys", "last", "policy for repeated KV keys (last, first, array)")
+	flag.String("kv-remainder-field", "", "field to keep text that is not a KV pair in instead of failing")
+	flag.String("csv-delimiter", ",", "delimiter between CSV columns (\\t for tab)")
+	flag.Bool("csv-lazy-quotes", false, "allow quotes in unquoted CSV columns")
+	flag.StringSlice("csv-columns", []string{}, "comma separated CSV column names")
+	flag.String("csv-schema-file", "", "JSON file of CSV column names selected by a discriminator column")
 	flag.Bool("keep-syslog", false,  "keep original syslog information")
 	flag.Bool("keep-message", false,  "keep the original syslog message")
+	flag.Bool("decode-structured-data", true, "decode RFC 5424 structured data into a nested object")
+	flag.String("dead-letter-file", "", "file to append messages that fail parsing to")
+	flag.Bool("dead-letter-outputs", false, "write messages that fail parsing to the outputs set by the dead-letter-output-params config")
 	flag.BoolP("verbose", "v", false, "verbose logging")
 	outputs.InitCLIParams()
 	flag.Parse()
@@ -47,26 +83,52 @@ func setupCliFlags() error {
 }
 
 func checkRequiredParams() error {
-	if !validIPAddress(viper.GetString("ip")) {
-		return errors.New("invalid ip param (--ip)")
+	if viper.GetInt("schedule") <= 0 {
+		return errors.New("invalid schedule param (--schedule)")
 	}
 
-	if viper.GetInt("port") < 0 || viper.GetInt("port") > 65535 {
-		return errors.New("invalid port param (--port)")
+	if viper.GetInt("max-batch-events") < 0 {
+		return errors.New("invalid max-batch-events param (--max-batch-events)")
 	}
 
-	if !contains([]string{"tcp", "udp", "both"}, viper.GetString("protocol")) {
-		return errors.New("invalid protocol param (--protocol)")
+	if viper.GetInt64("max-batch-bytes") < 0 {
+		return errors.New("invalid max-batch-bytes param (--max-batch-bytes)")
 	}
 
-	if !contains([]string{"grok", "json", "kv", "cef", "raw"}, viper.GetString("parser")) {
+	if viper.GetInt("shutdown-timeout") <= 0 {
+		return errors.New("invalid shutdown-timeout param (--shutdown-timeout)")
+	}
+
+	if err := checkListenerParams(); err != nil {
+		return err
+	}
+
+	if err := checkDeadLetterParams(); err != nil {
+		return err
+	}
+
+	if len(parserNames()) == 0 {
 		return errors.New("invalid parser param (--parser)")
 	}
 
-	if viper.GetString("parser") == "grok" && len(viper.GetStringSlice("grok-pattern")) == 0 {
+	for _, name := range parserNames() {
+		if !contains(parser.Names(), name) {
+			return fmt.Errorf("invalid parser param (--parser): unknown parser %s", name)
+		}
+	}
+
+	if contains(parserNames(), "grok") && len(stringArrayParam("grok-pattern")) == 0 {
 		return errors.New("invalid grok-pattern param (--grok-pattern)")
 	}
 
+	if contains(parserNames(), "regex") && len(stringArrayParam("regex-pattern")) == 0 {
+		return errors.New("invalid regex-pattern param (--regex-pattern)")
+	}
+
+	if _, err := newRouter(); err != nil {
+		return err
+	}
+
 	if err := outputs.ValidateCLIParams(); err != nil {
 		return err
 	}
@@ -74,6 +136,144 @@ func checkRequiredParams() error {
 	return nil
 }
 
+// parserNames returns the parser fallback chain from the parser param, which is either a
+// comma separated string or a list when supplied through a config file
+func parserNames() []string {
+	raw := viper.GetStringSlice("parser")
+	if len(raw) <= 1 {
+		raw = strings.Split(viper.GetString("parser"), ",")
+	}
+
+	return splitParserNames(strings.Join(raw, ","))
+}
+
+// parserParams are the params read by parserConfig, which may be overridden per route
+var parserParams = []string{
+	"grok-pattern", "grok-patterns-dir", "grok-pattern-file", "grok-field-type", "regex-pattern",
+	"cef-expand-keys", "cef-string-values", "kv-pair-separator", "kv-value-separator", "kv-quotes",
+	"kv-trim", "kv-duplicate-keys", "kv-remainder-field", "csv-delimiter", "csv-lazy-quotes",
+	"csv-columns", "csv-schema-file", "json-prefix-field", "json-decode-nested", "xml-prefix-field",
+	"xml-windows-event",
+}
+
+// parserConfig builds the parser configuration from the supplied parameters. Params set in the
+// options (a route's parser options) take precedence over the global params.
+func parserConfig(options *viper.Viper) (*parser.Config, error) {
+	params := parserParamReader{options: options}
+
+	fieldTypes, err := grokFieldTypes(params.getStringArray("grok-field-type"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &parser.Config{
+		GrokPatterns:     params.getStringArray("grok-pattern"),
+		GrokPatternsDir:  params.getString("grok-patterns-dir"),
+		GrokPatternFiles: params.getStringArray("grok-pattern-file"),
+		GrokFieldTypes:   fieldTypes,
+		CefExpandKeys:    params.getBool("cef-expand-keys"),
+		CefStringValues:  params.getBool("cef-string-values"),
+		KvPairSeparator:  params.getString("kv-pair-separator"),
+		KvValueSeparator: params.getString("kv-value-separator"),
+		KvQuotes:         params.getString("kv-quotes"),
+		KvTrim:           params.getBool("kv-trim"),
+		KvDuplicateKeys:  params.getString("kv-duplicate-keys"),
+		KvRemainderField: params.getString("kv-remainder-field"),
+		CsvDelimiter:     params.getString("csv-delimiter"),
+		CsvLazyQuotes:    params.getBool("csv-lazy-quotes"),
+		CsvColumns:       params.getStringSlice("csv-columns"),
+		CsvSchemaFile:    params.getString("csv-schema-file"),
+		RegexPatterns:    params.getStringArray("regex-pattern"),
+		JsonPrefixField:  params.getString("json-prefix-field"),
+		JsonDecodeNested: params.getBool("json-decode-nested"),
+		XmlPrefixField:   params.getString("xml-prefix-field"),
+		XmlWindowsEvent:  params.getBool("xml-windows-event"),
+	}, nil
+}
+
+// parserParamReader reads params from the options when set there, otherwise from the global params
+type parserParamReader struct {
+	options *viper.Viper
+}
+
+func (r parserParamReader) isSet(key string) bool {
+	return r.options != nil && r.options.IsSet(key)
+}
+
+func (r parserParamReader) getString(key string) string {
+	if r.isSet(key) {
+		return r.options.GetString(key)
+	}
+	return viper.GetString(key)
+}
+
+func (r parserParamReader) getBool(key string) bool {
+	if r.isSet(key) {
+		return r.options.GetBool(key)
+	}
+	return viper.GetBool(key)
+}
+
+// getStringSlice reads a list param. A single string option is split on commas, like the flag.
+func (r parserParamReader) getStringSlice(key string) []string {
+	if r.isSet(key) {
+		if value, ok := r.options.Get(key).(string); ok {
+			values := strings.Split(value, ",")
+			for i := range values {
+				values[i] = strings.TrimSpace(values[i])
+			}
+			return values
+		}
+		return r.options.GetStringSlice(key)
+	}
+	return viper.GetStringSlice(key)
+}
+
+// getStringArray reads a repeatable param. A single string option is a single value, so patterns
+// containing spaces or commas are kept whole.
+func (r parserParamReader) getStringArray(key string) []string {
+	if r.isSet(key) {
+		if value, ok := r.options.Get(key).(string); ok {
+			return []string{value}
+		}
+		return r.options.GetStringSlice(key)
+	}
+	return stringArrayParam(key)
+}
+
+// grokFieldTypes converts the field=type grok field type params to a map
+func grokFieldTypes(values []string) (map[string]string, error) {
+	fieldTypes := make(map[string]string)
+
+	for _, v := range values {
+		pair := strings.SplitN(v, "=", 2)
+		if len(pair) != 2 || strings.TrimSpace(pair[0]) == "" {
+			return nil, fmt.Errorf("invalid grok-field-type param (--grok-field-type): %s", v)
+		}
+		fieldTypes[strings.TrimSpace(pair[0])] = strings.TrimSpace(pair[1])
+	}
+
+	return fieldTypes, nil
+}
+
+// stringArrayParam returns the values of a string array param. Viper does not understand pflag
+// string arrays, so values supplied as flags are read from the flag set directly.
+func stringArrayParam(key string) []string {
+	if f := flag.Lookup(key); f != nil {
+		if f.Changed {
+			values, _ := flag.CommandLine.GetStringArray(key)
+			return values
+		}
+
+		// Viper falls back to the flag default string when not set by env or config
+		if viper.GetString(key) == f.DefValue {
+			return []string{}
+		}
+	}
+
+	return viper.GetStringSlice(key)
+}
+
 func contains(s []string, e string) bool {
 	for _, a := range s {
 		if a == e {
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rfizzle/collector-helpers/outputs"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"os"
+	"sync"
+	"time"
+)
+
+// deadLetter is a message that failed parsing along with the information needed to replay it
+type deadLetter struct {
+	Timestamp string                 `json:"timestamp"`
+	Parser    string                 `json:"parser"`
+	Error     string                 `json:"error"`
+	Message   string                 `json:"message"`
+	Syslog    map[string]interface{} `json:"syslog"`
+}
+
+// deadLetterWriter records messages that failed parsing to a dead-letter file and/or a temp
+// file batch that is shipped to the configured outputs.
+type deadLetterWriter struct {
+	lock      sync.Mutex
+	file      *os.File
+	tmpWriter *outputs.TmpWriter
+	outputs   map[string]interface{}
+	pending   int
+	unsent    []deadLetterBatch
+}
+
+// deadLetterBatch is a rotated dead-letter temp file waiting to be shipped to the outputs
+type deadLetterBatch struct {
+	path  string
+	count int
+}
+
+// checkDeadLetterParams validates the dead-letter output params. Dead-letters shipped to the outputs
+// need their own output params so they are not mixed in with the parsed events.
+func checkDeadLetterParams() error {
+	if !viper.GetBool("dead-letter-outputs") {
+		if viper.IsSet("dead-letter-output-params") {
+			return errors.New("invalid dead-letter-output-params param: requires dead-letter-outputs")
+		}
+		return nil
+	}
+
+	if len(viper.GetStringMap("dead-letter-output-params")) == 0 {
+		return errors.New("invalid dead-letter-outputs param: requires dead-letter-output-params")
+	}
+
+	values := viper.GetStringMap("dead-letter-output-params")
+	for key := range values {
+		if !isOutputParam(key) {
+			return fmt.Errorf("invalid dead-letter-output-params param: unknown output option %s", key)
+		}
+	}
+
+	if err := withOutputParams(values, outputs.ValidateCLIParams); err != nil {
+		return fmt.Errorf("invalid dead-letter-output-params param: %v", err)
+	}
+
+	return nil
+}
+
+// newDeadLetterWriter sets up the dead-letter sinks from the supplied params. Returns nil when
+// dead-lettering is disabled.
+func newDeadLetterWriter() (*deadLetterWriter, error) {
+	if viper.GetString("dead-letter-file") == "" && !viper.GetBool("dead-letter-outputs") {
+		return nil, nil
+	}
+
+	d := &deadLetterWriter{}
+
+	// Open dead-letter file for appending
+	if viper.GetString("dead-letter-file") != "" {
+		fp, err := os.OpenFile(viper.GetString("dead-letter-file"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open dead-letter file: %v", err)
+		}
+		d.file = fp
+	}
+
+	// Setup temp writer for batches shipped to outputs
+	if viper.GetBool("dead-letter-outputs") {
+		tmpWriter, err := outputs.NewTmpWriter()
+		if err != nil {
+			return nil, fmt.Errorf("unable to setup dead-letter temp file: %v", err)
+		}
+		d.tmpWriter = tmpWriter
+		d.outputs = viper.GetStringMap("dead-letter-output-params")
+	}
+
+	return d, nil
+}
+
+// Write records a message that failed parsing
+func (d *deadLetterWriter) Write(message string, logParts map[string]interface{}, parserName string, parseErr error) error {
+	if d == nil {
+		return nil
+	}
+
+	jsonString, err := json.Marshal(&deadLetter{
+		Timestamp: time.Now().Format(time.RFC3339),
+		Parser:    parserName,
+		Error:     parseErr.Error(),
+		Message:   message,
+		Syslog:    logParts,
+	})
+
+	if err != nil {
+		return fmt.Errorf("unable to marshal dead-letter: %v", err)
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.file != nil {
+		if _, err := d.file.Write(append(jsonString, '\n')); err != nil {
+			return fmt.Errorf("unable to write dead-letter file: %v", err)
+		}
+	}
+
+	if d.tmpWriter != nil {
+		if err := d.tmpWriter.WriteLog(string(jsonString)); err != nil {
+			return fmt.Errorf("unable to write dead-letter temp file: %v", err)
+		}
+		d.pending += 1
+	}
+
+	return nil
+}
+
+// Sync commits the dead-letter file and temp file to disk
+func (d *deadLetterWriter) Sync() error {
+	if d == nil {
+		return nil
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.file != nil {
+		if err := d.file.Sync(); err != nil {
+			return fmt.Errorf("unable to sync dead-letter file: %v", err)
+		}
+	}
+
+	if d.tmpWriter != nil {
+		if err := d.tmpWriter.Fp.Sync(); err != nil {
+			return fmt.Errorf("unable to sync dead-letter temp file: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// Pending returns the number of dead-letters waiting to be shipped to the outputs
+func (d *deadLetterWriter) Pending() int {
+	if d == nil {
+		return 0
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.pending
+}
+
+// Flush rotates the dead-letter batch and ships it to the configured outputs, overridden by the
+// dead-letter output params. Batches that failed to ship are kept on disk and retried on the next flush.
+func (d *deadLetterWriter) Flush(timestamp string) error {
+	if d == nil || d.tmpWriter == nil {
+		return nil
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	// Rotate the current batch into the list of files to ship
+	if d.pending > 0 {
+		if err := d.tmpWriter.Rotate(); err != nil {
+			return fmt.Errorf("unable to rotate dead-letter temp file: %v", err)
+		}
+
+		d.unsent = append(d.unsent, deadLetterBatch{path: d.tmpWriter.LastFilePath, count: d.pending})
+		d.pending = 0
+	}
+
+	// Write to outputs
+	var errs []error
+	unsent := make([]deadLetterBatch, 0)
+	for _, batch := range d.unsent {
+		err := withOutputParams(d.outputs, func() error {
+			return outputs.WriteToOutputs(batch.path, timestamp)
+		})
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to write %v dead-letters to output (temporary file kept: %s): %v", batch.count, batch.path, err))
+			unsent = append(unsent, batch)
+			continue
+		}
+
+		log.Infof("%v dead-letters processed...", batch.count)
+
+		// Remove temp file now
+		if err := os.Remove(batch.path); err != nil {
+			errs = append(errs, fmt.Errorf("unable to remove dead-letter tmp file: %v", err))
+		}
+	}
+	d.unsent = unsent
+
+	if len(errs) > 0 {
+		return fmt.Errorf("error flushing dead-letters: %v", errs)
+	}
+
+	return nil
+}
+
+// Close closes the dead-letter file and removes the dead-letter temp file. Dead-letters that were
+// never shipped to the outputs are kept on disk.
+func (d *deadLetterWriter) Close() error {
+	if d == nil {
+		return nil
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	var errs []error
+
+	if d.file != nil {
+		if err := d.file.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if d.tmpWriter != nil {
+		if err := d.tmpWriter.Close(); err != nil {
+			errs = append(errs, err)
+		}
+
+		if d.pending > 0 {
+			log.Errorf("%v dead-letters not shipped, temporary file kept: %s", d.pending, d.tmpWriter.LastFilePath)
+		} else if err := os.Remove(d.tmpWriter.LastFilePath); err != nil {
+			errs = append(errs, err)
+		}
+
+		for _, batch := range d.unsent {
+			log.Errorf("%v dead-letters not shipped, temporary file kept: %s", batch.count, batch.path)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("error closing dead-letter writer: %v", errs)
+	}
+
+	return nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/rfizzle/collector-helpers/outputs"
+	flag "github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDeadLetterWriter(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	dir, err := ioutil.TempDir("", "syslog-collector")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	deadLetterFile := filepath.Join(dir, "dead-letters.log")
+	outputFile := filepath.Join(dir, "out.log")
+
+	viper.Set("dead-letter-file", deadLetterFile)
+	viper.Set("dead-letter-outputs", true)
+	viper.Set("file", true)
+
+	d, err := newDeadLetterWriter()
+	if err != nil {
+		t.Fatalf("failed to create dead-letter writer: %v", err)
+	}
+
+	if err := d.Write("not json", map[string]interface{}{"hostname": "host1"}, "json", errors.New("string is not in json format")); err != nil {
+		t.Fatalf("failed to write dead-letter: %v", err)
+	}
+
+	if err := d.Sync(); err != nil {
+		t.Errorf("failed to sync dead-letters: %v", err)
+	}
+
+	// The dead-letter file holds a JSON line per message
+	content, err := ioutil.ReadFile(deadLetterFile)
+	if err != nil {
+		t.Fatalf("failed to read dead-letter file: %v", err)
+	}
+
+	var letter deadLetter
+	if err := json.Unmarshal([]byte(strings.TrimSuffix(string(content), "\n")), &letter); err != nil {
+		t.Fatalf("failed to unmarshal dead-letter %q: %v", content, err)
+	}
+
+	if letter.Message != "not json" || letter.Parser != "json" || letter.Error != "string is not in json format" || letter.Syslog["hostname"] != "host1" {
+		t.Errorf("dead-letter got %+v; expected the failed message", letter)
+	}
+
+	if d.Pending() != 1 {
+		t.Errorf("d.Pending() got %d; expected %d", d.Pending(), 1)
+	}
+
+	// Batches that fail to ship are kept
+	viper.Set("file-path", filepath.Join(dir, "missing", "out.log"))
+
+	if err := d.Flush("2020-10-17T10:00:00Z"); err == nil {
+		t.Errorf("failed to error when the dead-letters cannot be shipped")
+	}
+
+	if d.Pending() != 0 || len(d.unsent) != 1 {
+		t.Fatalf("d.Pending() and d.unsent got %d, %d; expected the batch to be kept", d.Pending(), len(d.unsent))
+	}
+
+	if _, err := os.Stat(d.unsent[0].path); err != nil {
+		t.Errorf("failed to keep unsent dead-letter file: %v", err)
+	}
+
+	// Kept batches are retried on the next flush
+	viper.Set("file-path", outputFile)
+
+	if err := d.Write("second", map[string]interface{}{}, "json", errors.New("failed")); err != nil {
+		t.Fatalf("failed to write dead-letter: %v", err)
+	}
+
+	unsentPath := d.unsent[0].path
+
+	if err := d.Flush("2020-10-17T10:00:00Z"); err != nil {
+		t.Errorf("failed to flush dead-letters: %v", err)
+	}
+
+	if d.Pending() != 0 || len(d.unsent) != 0 {
+		t.Errorf("d.Pending() and d.unsent got %d, %d; expected all batches to be shipped", d.Pending(), len(d.unsent))
+	}
+
+	if _, err := os.Stat(unsentPath); !os.IsNotExist(err) {
+		t.Errorf("failed to remove shipped dead-letter file: %v", err)
+	}
+
+	if content, _ := ioutil.ReadFile(outputFile); strings.Count(string(content), "\n") != 2 {
+		t.Errorf("output got %q; expected two dead-letters", content)
+	}
+
+	// Close keeps dead-letters that were never shipped
+	viper.Set("file-path", filepath.Join(dir, "missing", "out.log"))
+
+	if err := d.Write("third", map[string]interface{}{}, "json", errors.New("failed")); err != nil {
+		t.Fatalf("failed to write dead-letter: %v", err)
+	}
+
+	if err := d.Flush("2020-10-17T10:00:00Z"); err == nil {
+		t.Errorf("failed to error when the dead-letters cannot be shipped")
+	}
+
+	if err := d.Write("fourth", map[string]interface{}{}, "json", errors.New("failed")); err != nil {
+		t.Fatalf("failed to write dead-letter: %v", err)
+	}
+
+	unsentPath = d.unsent[0].path
+
+	if err := d.Close(); err != nil {
+		t.Errorf("failed to close dead-letter writer: %v", err)
+	}
+
+	for _, path := range []string{unsentPath, d.tmpWriter.LastFilePath} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("failed to keep unsent dead-letter file: %v", err)
+		}
+		os.Remove(path)
+	}
+}
+
+func TestDeadLetterWriterDisabled(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	d, err := newDeadLetterWriter()
+
+	if err != nil || d != nil {
+		t.Fatalf("newDeadLetterWriter() got %v, %v; expected dead-lettering to be disabled", d, err)
+	}
+
+	// A disabled writer ignores dead-letters
+	if err := d.Write("not json", map[string]interface{}{}, "json", errors.New("failed")); err != nil {
+		t.Errorf("failed to ignore dead-letter: %v", err)
+	}
+
+	if d.Pending() != 0 || d.Flush("") != nil || d.Close() != nil {
+		t.Errorf("failed to ignore dead-letters when disabled")
+	}
+}
+
+func TestDeadLetterOutputParams(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	dir, err := ioutil.TempDir("", "syslog-collector")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	eventsFile := filepath.Join(dir, "events.log")
+	deadLetterFile := filepath.Join(dir, "dead-letters.log")
+
+	viper.Set("dead-letter-outputs", true)
+	viper.Set("file", true)
+	viper.Set("file-path", eventsFile)
+	viper.Set("dead-letter-output-params", map[string]interface{}{"file-path": deadLetterFile})
+
+	d, err := newDeadLetterWriter()
+	if err != nil {
+		t.Fatalf("failed to create dead-letter writer: %v", err)
+	}
+
+	if err := d.Write("not json", map[string]interface{}{}, "json", errors.New("failed")); err != nil {
+		t.Fatalf("failed to write dead-letter: %v", err)
+	}
+
+	if err := d.Flush("2020-10-17T10:00:00Z"); err != nil {
+		t.Errorf("failed to flush dead-letters: %v", err)
+	}
+
+	if content, _ := ioutil.ReadFile(deadLetterFile); strings.Count(string(content), "\n") != 1 {
+		t.Errorf("dead-letter output got %q; expected one dead-letter", content)
+	}
+
+	if _, err := os.Stat(eventsFile); !os.IsNotExist(err) {
+		t.Errorf("dead-letters were written to the event output")
+	}
+
+	if viper.GetString("file-path") != eventsFile {
+		t.Errorf(`viper.GetString("file-path") got %s; expected %s`, viper.GetString("file-path"), eventsFile)
+	}
+
+	if err := d.Close(); err != nil {
+		t.Errorf("failed to close dead-letter writer: %v", err)
+	}
+}
+
+func TestCheckDeadLetterParams(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	if flag.Lookup("s3-bucket") == nil {
+		outputs.InitCLIParams()
+	}
+
+	if err := checkDeadLetterParams(); err != nil {
+		t.Errorf("checkDeadLetterParams() failed without dead-letter output params: %v", err)
+	}
+
+	// Dead-letters are not shipped to the outputs of the parsed events
+	viper.Set("dead-letter-outputs", true)
+
+	if err := checkDeadLetterParams(); err == nil {
+		t.Errorf("checkDeadLetterParams() failed to error without dead-letter output params")
+	}
+
+	viper.Set("dead-letter-output-params", map[string]interface{}{})
+
+	if err := checkDeadLetterParams(); err == nil {
+		t.Errorf("checkDeadLetterParams() failed to error on empty dead-letter output params")
+	}
+
+	viper.Set("dead-letter-outputs", false)
+	viper.Set("dead-letter-output-params", map[string]interface{}{"s3-path": "dead-letters"})
+
+	if err := checkDeadLetterParams(); err == nil {
+		t.Errorf("checkDeadLetterParams() failed to error without dead-letter-outputs")
+	}
+
+	viper.Set("dead-letter-outputs", true)
+
+	if err := checkDeadLetterParams(); err != nil {
+		t.Errorf("checkDeadLetterParams() failed: %v", err)
+	}
+
+	viper.Set("dead-letter-output-params", map[string]interface{}{"s3-pth": "dead-letters"})
+
+	if err := checkDeadLetterParams(); err == nil {
+		t.Errorf("checkDeadLetterParams() failed to error on an unknown output option")
+	}
+}
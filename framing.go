@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"gopkg.in/mcuadros/go-syslog.v2"
+	"gopkg.in/mcuadros/go-syslog.v2/format"
+	"strconv"
+	"strings"
+)
+
+// framingModes are the supported framings of TCP and TLS messages
+var framingModes = []string{"auto", "newline", "octet-counting", "delimiter"}
+
+// maxFrameSize is the largest frame the syslog server can scan (the bufio.Scanner default)
+const maxFrameSize = bufio.MaxScanTokenSize
+
+// framedFormat detects the syslog format of each message like syslog.Automatic but splits the TCP
+// stream into messages using the configured framing
+type framedFormat struct {
+	split bufio.SplitFunc
+}
+
+func (f *framedFormat) GetParser(line []byte) format.LogParser {
+	return syslog.Automatic.GetParser(line)
+}
+
+func (f *framedFormat) GetSplitFunc() bufio.SplitFunc {
+	return f.split
+}
+
+// newFramedFormat returns the syslog format for the framing mode. The delimiter is only used by
+// the delimiter mode.
+func newFramedFormat(mode string, delimiter string) (*framedFormat, error) {
+	switch mode {
+	case "", "auto":
+		return &framedFormat{split: splitAutoFrame}, nil
+	case "newline":
+		return &framedFormat{split: splitNewlineFrame}, nil
+	case "octet-counting":
+		return &framedFormat{split: splitOctetCountedFrame}, nil
+	case "delimiter":
+		d, err := parseFrameDelimiter(delimiter)
+		if err != nil {
+			return nil, err
+		}
+		return &framedFormat{split: splitDelimitedFrame(d)}, nil
+	}
+
+	return nil, fmt.Errorf("unknown framing %s", mode)
+}
+
+// parseFrameDelimiter decodes the escape sequences (\0, \n, \x00, ...) of the delimiter
+func parseFrameDelimiter(value string) ([]byte, error) {
+	if value == `\0` {
+		return []byte{0}, nil
+	}
+
+	delimiter, err := strconv.Unquote(`"` + strings.ReplaceAll(value, `"`, `\"`) + `"`)
+	if err != nil {
+		return nil, fmt.Errorf("invalid frame delimiter %q: %v", value, err)
+	}
+
+	if delimiter == "" {
+		return nil, errors.New("empty frame delimiter")
+	}
+
+	return []byte(delimiter), nil
+}
+
+// splitAutoFrame reads an octet-counted frame when the frame starts with a number followed by a
+// space and a newline terminated frame otherwise (syslog messages start with a < or a letter, or a
+// timestamp when they have no PRI)
+func splitAutoFrame(data []byte, atEOF bool) (int, []byte, error) {
+	skip := skipFrameWhitespace(data)
+
+	// Read the leading digits
+	i := skip
+	for i < len(data) && i-skip <= len(strconv.Itoa(maxFrameSize)) && data[i] >= '0' && data[i] <= '9' {
+		i++
+	}
+
+	// Wait for the rest of a possible frame length
+	if i > skip && i == len(data) && !atEOF && i-skip <= len(strconv.Itoa(maxFrameSize)) {
+		return skip, nil, nil
+	}
+
+	if i > skip && i < len(data) && data[i] == ' ' {
+		return splitOctetCountedFrame(data, atEOF)
+	}
+
+	return splitNewlineFrame(data, atEOF)
+}
+
+// splitNewlineFrame reads a frame terminated by LF (or CRLF), skipping empty frames
+func splitNewlineFrame(data []byte, atEOF bool) (int, []byte, error) {
+	split := splitDelimitedFrame([]byte{'\n'})
+	advance := 0
+
+	for {
+		n, token, err := split(data[advance:], atEOF)
+		if err != nil || token == nil {
+			return advance + n, token, err
+		}
+
+		advance += n
+		if token = bytes.TrimSuffix(token, []byte{'\r'}); len(token) > 0 {
+			return advance, token, nil
+		}
+	}
+}
+
+// splitOctetCountedFrame reads an RFC 6587 octet-counted frame (MSG-LEN SP SYSLOG-MSG). Whitespace
+// between frames is skipped, as some senders terminate octet-counted frames with a newline.
+func splitOctetCountedFrame(data []byte, atEOF bool) (int, []byte, error) {
+	skip := skipFrameWhitespace(data)
+	if skip == len(data) {
+		return len(data), nil, nil
+	}
+
+	// Read the frame length
+	i := bytes.IndexByte(data[skip:], ' ')
+	if i < 0 {
+		if len(data)-skip > len(strconv.Itoa(maxFrameSize)) {
+			return 0, nil, errors.New("invalid octet-counted frame: missing length")
+		}
+		if atEOF {
+			return 0, nil, errors.New("invalid octet-counted frame: unexpected end of stream")
+		}
+		return skip, nil, nil
+	}
+
+	length, err := strconv.Atoi(string(data[skip : skip+i]))
+	if err != nil || length <= 0 {
+		return 0, nil, fmt.Errorf("invalid octet-counted frame length %q", data[skip:skip+i])
+	}
+
+	if length > maxFrameSize-i-1 {
+		return 0, nil, fmt.Errorf("octet-counted frame of %d bytes exceeds the maximum frame size", length)
+	}
+
+	// Wait for the rest of the frame
+	start := skip + i + 1
+	end := start + length
+	if len(data) < end {
+		if atEOF {
+			return 0, nil, errors.New("invalid octet-counted frame: unexpected end of stream")
+		}
+		return skip, nil, nil
+	}
+
+	return end, data[start:end], nil
+}
+
+// splitDelimitedFrame returns a split function for frames terminated by the delimiter, skipping
+// empty frames. A frame left without a delimiter at the end of the stream is still returned.
+func splitDelimitedFrame(delimiter []byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		advance := 0
+
+		for {
+			i := bytes.Index(data[advance:], delimiter)
+
+			if i < 0 {
+				if atEOF && advance < len(data) {
+					return len(data), data[advance:], nil
+				}
+				return advance, nil, nil
+			}
+
+			if i > 0 {
+				return advance + i + len(delimiter), data[advance : advance+i], nil
+			}
+
+			advance += len(delimiter)
+		}
+	}
+}
+
+// skipFrameWhitespace returns the number of whitespace bytes at the start of the data
+func skipFrameWhitespace(data []byte) int {
+	for i, c := range data {
+		if c != '\n' && c != '\r' && c != ' ' && c != '\t' && c != 0 {
+			return i
+		}
+	}
+
+	return len(data)
+}
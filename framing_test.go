@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// scanFrames splits the stream into frames with the split function
+func scanFrames(stream string, split bufio.SplitFunc) ([]string, error) {
+	scanner := bufio.NewScanner(strings.NewReader(stream))
+	scanner.Split(split)
+
+	frames := make([]string, 0)
+	for scanner.Scan() {
+		frames = append(frames, scanner.Text())
+	}
+
+	return frames, scanner.Err()
+}
+
+// octetCounted frames the message with its length
+func octetCounted(message string) string {
+	return fmt.Sprintf("%d %s", len(message), message)
+}
+
+func TestSplitFrames(t *testing.T) {
+	multiLine := "<13>Oct 17 10:00:00 host app: line one\n  at line two\n"
+
+	tests := []struct {
+		name     string
+		mode     string
+		stream   string
+		expected []string
+	}{
+		{"newline", "newline", "<13>a\n<13>b\n", []string{"<13>a", "<13>b"}},
+		{"newline crlf", "newline", "<13>a\r\n<13>b\r\n", []string{"<13>a", "<13>b"}},
+		{"newline empty crlf", "newline", "\r\n\r\n<13>a\r\n\r\n\r\n<13>b", []string{"<13>a", "<13>b"}},
+		{"newline unterminated", "newline", "<13>a\n<13>b", []string{"<13>a", "<13>b"}},
+		{"octet-counting", "octet-counting", octetCounted("<13>a") + octetCounted("<13>b"), []string{"<13>a", "<13>b"}},
+		{"octet-counting multi-line", "octet-counting", octetCounted(multiLine) + octetCounted("<13>b"), []string{multiLine, "<13>b"}},
+		{"octet-counting trailing newline", "octet-counting", octetCounted("<13>a") + "\n" + octetCounted("<13>b") + "\n", []string{"<13>a", "<13>b"}},
+		{"auto octet-counting", "auto", octetCounted(multiLine) + octetCounted("<13>b"), []string{multiLine, "<13>b"}},
+		{"auto newline", "auto", "<13>a\n<13>b\n", []string{"<13>a", "<13>b"}},
+		{"auto newline timestamp", "auto", "2020-10-17T10:00:00Z host app: hello\n<13>b\n", []string{"2020-10-17T10:00:00Z host app: hello", "<13>b"}},
+		{"auto newline number", "auto", "12345\n" + octetCounted("<13>b"), []string{"12345", "<13>b"}},
+		{"auto mixed", "auto", octetCounted("<13>a\nb") + "<13>c\n" + octetCounted("<13>d"), []string{"<13>a\nb", "<13>c", "<13>d"}},
+		{"delimiter nul", "delimiter", "<13>a\nb\x00<13>c\x00\x00<13>d\x00", []string{"<13>a\nb", "<13>c", "<13>d"}},
+		{"delimiter nul unterminated", "delimiter", "<13>a\x00<13>b", []string{"<13>a", "<13>b"}},
+	}
+
+	for _, test := range tests {
+		f, err := newFramedFormat(test.mode, `\0`)
+
+		if err != nil {
+			t.Fatalf("%s: failed to create framed format: %v", test.name, err)
+		}
+
+		frames, err := scanFrames(test.stream, f.GetSplitFunc())
+
+		if err != nil {
+			t.Errorf("%s: failed to split frames: %v", test.name, err)
+			continue
+		}
+
+		if fmt.Sprintf("%q", frames) != fmt.Sprintf("%q", test.expected) {
+			t.Errorf("%s: got %q; expected %q", test.name, frames, test.expected)
+		}
+	}
+}
+
+func TestSplitFramesInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+	}{
+		{"non-numeric length", "12a <13>message"},
+		{"zero length", "0 <13>message"},
+		{"oversized length", fmt.Sprintf("%d <13>message", maxFrameSize)},
+		{"missing length", strings.Repeat("1", 20)},
+		{"truncated frame", "20 <13>message"},
+	}
+
+	for _, test := range tests {
+		if frames, err := scanFrames(test.stream, splitOctetCountedFrame); err == nil {
+			t.Errorf("%s: failed to error on invalid octet-counted frame, got %q", test.name, frames)
+		}
+	}
+}
+
+func TestSplitOctetCountedFramePartial(t *testing.T) {
+	stream := []byte(octetCounted("<13>message"))
+
+	// Every prefix of the frame must ask for more data
+	for i := 1; i < len(stream); i++ {
+		advance, token, err := splitOctetCountedFrame(stream[:i], false)
+
+		if err != nil || token != nil || advance != 0 {
+			t.Errorf("splitOctetCountedFrame(%q) got %d, %q, %v; expected more data", stream[:i], advance, token, err)
+		}
+
+		advance, token, err = splitAutoFrame(stream[:i], false)
+
+		if err != nil || token != nil || advance != 0 {
+			t.Errorf("splitAutoFrame(%q) got %d, %q, %v; expected more data", stream[:i], advance, token, err)
+		}
+	}
+
+	advance, token, err := splitOctetCountedFrame(stream, false)
+
+	if err != nil || advance != len(stream) || string(token) != "<13>message" {
+		t.Errorf("splitOctetCountedFrame(%q) got %d, %q, %v", stream, advance, token, err)
+	}
+}
+
+func TestParseFrameDelimiter(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected []byte
+	}{
+		{`\0`, []byte{0}},
+		{`\x00`, []byte{0}},
+		{`\n`, []byte{'\n'}},
+		{`\r\n`, []byte{'\r', '\n'}},
+		{`\x1e`, []byte{0x1e}},
+		{`|`, []byte{'|'}},
+		{`"`, []byte{'"'}},
+	}
+
+	for _, test := range tests {
+		delimiter, err := parseFrameDelimiter(test.value)
+
+		if err != nil {
+			t.Errorf("parseFrameDelimiter(%q) failed: %v", test.value, err)
+		} else if !bytes.Equal(delimiter, test.expected) {
+			t.Errorf("parseFrameDelimiter(%q) got %q; expected %q", test.value, delimiter, test.expected)
+		}
+	}
+
+	for _, value := range []string{"", `\`, `\q`} {
+		if _, err := parseFrameDelimiter(value); err == nil {
+			t.Errorf("parseFrameDelimiter(%q) failed to error on invalid delimiter", value)
+		}
+	}
+
+	if _, err := newFramedFormat("unknown", `\0`); err == nil {
+		t.Errorf("newFramedFormat failed to error on unknown framing")
+	}
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/rfizzle/collector-helpers/outputs"
+	log "github.com/sirupsen/logrus"
+	flag "github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"gopkg.in/mcuadros/go-syslog.v2"
+	"gopkg.in/mcuadros/go-syslog.v2/format"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// outputParams are the prefixes of the output params that can be overridden per listener
+var outputParams = []string{"file", "gcs", "s3", "stackdriver", "http", "pubsub"}
+
+// listenerConfig is a listener as supplied in the listeners param. Without a listeners param a
+// single unnamed listener is built from the ip, port and protocol params.
+type listenerConfig struct {
+	Name           string
+	IP             string
+	Port           int
+	Protocol       string
+	Framing        string `mapstructure:"tcp-framing"`
+	FrameDelimiter string `mapstructure:"tcp-frame-delimiter"`
+	SocketPath     string `mapstructure:"socket-path"`
+	SocketMode     string `mapstructure:"socket-mode"`
+	Parser         string
+	Options        map[string]interface{}
+	Tags           []string
+	Outputs        map[string]interface{}
+}
+
+// listenerServer is a running listener (a syslog server or a RELP server)
+type listenerServer interface {
+	Kill() error
+	Wait()
+}
+
+// listenerHandler stamps the listener name and tags on each message before handing it to the
+// event loop
+type listenerHandler struct {
+	name         string
+	tags         []string
+	fillHostname bool
+	channel      syslog.LogPartsChannel
+}
+
+func (h *listenerHandler) Handle(logParts format.LogParts, messageLength int64, err error) {
+	// The syslog server only falls back to the client address for a missing hostname with its
+	// own formats, so do the same for framed TCP and RELP messages
+	if hostname, _ := logParts["hostname"].(string); h.fillHostname && hostname == "" {
+		client, _ := logParts["client"].(string)
+		if host, _, err := net.SplitHostPort(client); err == nil {
+			client = host
+		}
+		logParts["hostname"] = client
+	}
+
+	if h.name != "" {
+		logParts["listener"] = h.name
+		if len(h.tags) > 0 {
+			logParts["tags"] = h.tags
+		}
+	}
+
+	h.channel <- logParts
+}
+
+// handleSocketMessage parses the syslog message and hands it to the event loop along with the
+// TLS peer certificate subject and the credentials of the peer, if known
+func handleSocketMessage(handler *listenerHandler, message []byte, addr net.Addr, tlsPeer string, credentials *peerCredentials) {
+	parser := syslog.Automatic.GetParser(message)
+	err := parser.Parse()
+
+	logParts := parser.Dump()
+	logParts["client"] = ""
+	if addr != nil {
+		logParts["client"] = addr.String()
+	}
+	logParts["tls_peer"] = tlsPeer
+
+	if credentials != nil {
+		logParts["peer_pid"] = credentials.pid
+		logParts["peer_uid"] = credentials.uid
+		logParts["peer_gid"] = credentials.gid
+	}
+
+	handler.Handle(logParts, int64(len(message)), err)
+}
+
+// listenerConfigs returns the configured listeners
+func listenerConfigs() ([]listenerConfig, error) {
+	if !viper.IsSet("listeners") {
+		return []listenerConfig{{
+			IP:             viper.GetString("ip"),
+			Port:           viper.GetInt("port"),
+			Protocol:       viper.GetString("protocol"),
+			Framing:        viper.GetString("tcp-framing"),
+			FrameDelimiter: viper.GetString("tcp-frame-delimiter"),
+			SocketPath:     viper.GetString("socket-path"),
+			SocketMode:     viper.GetString("socket-mode"),
+		}}, nil
+	}
+
+	configs := make([]listenerConfig, 0)
+	if err := viper.UnmarshalKey("listeners", &configs); err != nil {
+		return nil, fmt.Errorf("invalid listeners param: %v", err)
+	}
+
+	if len(configs) == 0 {
+		return nil, errors.New("invalid listeners param: no listeners")
+	}
+
+	// Default to the global framing params
+	for i := range configs {
+		if configs[i].Framing == "" {
+			configs[i].Framing = viper.GetString("tcp-framing")
+		}
+		if configs[i].FrameDelimiter == "" {
+			configs[i].FrameDelimiter = viper.GetString("tcp-frame-delimiter")
+		}
+		if configs[i].SocketMode == "" {
+			configs[i].SocketMode = viper.GetString("socket-mode")
+		}
+	}
+
+	return configs, nil
+}
+
+// checkListenerParams validates the listeners param, or the ip, port and protocol params when
+// there is no listeners param
+func checkListenerParams() error {
+	configs, err := listenerConfigs()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(configs))
+	for _, l := range configs {
+		// Listeners from the listeners param are validated under their own name
+		param := func(key string) string {
+			if l.Name == "" {
+				return fmt.Sprintf("%s param (--%s)", key, key)
+			}
+			return fmt.Sprintf("%s for listener %s", key, l.Name)
+		}
+
+		if viper.IsSet("listeners") {
+			if l.Name == "" || contains(names, l.Name) {
+				return fmt.Errorf("invalid listeners param: missing or duplicate listener name %q", l.Name)
+			}
+			names = append(names, l.Name)
+		}
+
+		if !contains([]string{"tcp", "udp", "both", "tls", "relp", "unix", "unixgram"}, l.Protocol) {
+			return fmt.Errorf("invalid %s", param("protocol"))
+		}
+
+		if l.Protocol == "unix" || l.Protocol == "unixgram" {
+			// Unix sockets listen on a socket path instead of an address
+			if l.SocketPath == "" {
+				return fmt.Errorf("invalid %s", param("socket-path"))
+			}
+
+			if _, err := parseSocketMode(l.SocketMode); err != nil {
+				return fmt.Errorf("invalid %s: %v", param("socket-mode"), err)
+			}
+		} else {
+			if !validIPAddress(l.IP) {
+				return fmt.Errorf("invalid %s", param("ip"))
+			}
+
+			if l.Port < 0 || l.Port > 65535 {
+				return fmt.Errorf("invalid %s", param("port"))
+			}
+		}
+
+		if l.Protocol == "tls" {
+			if err := checkTLSParams(); err != nil {
+				return err
+			}
+		}
+
+		if !contains(framingModes, l.Framing) {
+			return fmt.Errorf("invalid %s", param("tcp-framing"))
+		}
+
+		if _, err := newFramedFormat(l.Framing, l.FrameDelimiter); err != nil {
+			return fmt.Errorf("invalid %s: %v", param("tcp-frame-delimiter"), err)
+		}
+
+		for key := range l.Outputs {
+			if !isOutputParam(key) {
+				return fmt.Errorf("invalid listener %s: unknown output option %s", l.Name, key)
+			}
+		}
+
+		if err := withOutputParams(l.Outputs, outputs.ValidateCLIParams); err != nil {
+			return fmt.Errorf("invalid listener %s: %v", l.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// listenerProtocols returns the protocols to bind for the listener. TCP and UDP are served
+// separately for the both protocol as the TCP framing does not apply to datagrams.
+func listenerProtocols(l listenerConfig) []string {
+	if l.Protocol == "both" {
+		return []string{"tcp", "udp"}
+	}
+
+	return []string{l.Protocol}
+}
+
+// startListener boots a syslog server for the protocol of the listener
+func startListener(l listenerConfig, protocol string, channel syslog.LogPartsChannel) (listenerServer, error) {
+	address := fmt.Sprintf("%s:%d", l.IP, l.Port)
+	handler := &listenerHandler{name: l.Name, tags: l.Tags, channel: channel}
+
+	// Setup RELP listener
+	if protocol == "relp" {
+		handler.fillHostname = true
+
+		log.Infof("listening on %s/%s", address, "RELP")
+		server, err := startRelpServer(address, handler)
+		if err != nil {
+			return nil, fmt.Errorf("unable to start RELP listener on %s: %v", address, err)
+		}
+
+		return server, nil
+	}
+
+	// Setup unix socket listeners
+	if protocol == "unix" {
+		log.Infof("listening on %s/%s (%s framing)", l.SocketPath, "UNIX", l.Framing)
+		server, err := startUnixServer(l, handler)
+		if err != nil {
+			return nil, fmt.Errorf("unable to start unix listener on %s: %v", l.SocketPath, err)
+		}
+
+		return server, nil
+	}
+
+	if protocol == "unixgram" {
+		log.Infof("listening on %s/%s", l.SocketPath, "UNIXGRAM")
+		server, err := startUnixgramServer(l, handler)
+		if err != nil {
+			return nil, fmt.Errorf("unable to start unixgram listener on %s: %v", l.SocketPath, err)
+		}
+
+		return server, nil
+	}
+
+	// Setup TCP and TLS listeners
+	if protocol == "tcp" || protocol == "tls" {
+		handler.fillHostname = true
+
+		var tlsConfig *tls.Config
+		if protocol == "tls" {
+			var err error
+			if tlsConfig, err = setupTLSConfig(); err != nil {
+				return nil, err
+			}
+		}
+
+		log.Infof("listening on %s/%s (%s framing)", address, strings.ToUpper(protocol), l.Framing)
+		server, err := startTCPServer(l, address, tlsConfig, handler)
+		if err != nil {
+			return nil, fmt.Errorf("unable to start %s listener on %s: %v", strings.ToUpper(protocol), address, err)
+		}
+
+		return server, nil
+	}
+
+	// Setup UDP listener
+	server := syslog.NewServer()
+	server.SetFormat(syslog.Automatic)
+	server.SetHandler(handler)
+
+	log.Infof("listening on %s/%s", address, "UDP")
+	if err := server.ListenUDP(address); err != nil {
+		return nil, fmt.Errorf("unable to start UDP listener on %s", address)
+	}
+
+	// Boot up server
+	if err := server.Boot(); err != nil {
+		return nil, fmt.Errorf("unable to boot syslog service: %v", err)
+	}
+
+	return server, nil
+}
+
+// startListeners boots the syslog servers of each listener that hand their messages to the channel
+func startListeners(configs []listenerConfig, channel syslog.LogPartsChannel) ([]listenerServer, error) {
+	servers := make([]listenerServer, 0, len(configs))
+
+	for _, l := range configs {
+		for _, protocol := range listenerProtocols(l) {
+			server, err := startListener(l, protocol, channel)
+			if err != nil {
+				return nil, err
+			}
+
+			servers = append(servers, server)
+		}
+	}
+
+	return servers, nil
+}
+
+// isOutputParam returns whether the key is a registered output param
+func isOutputParam(key string) bool {
+	if flag.Lookup(key) == nil {
+		return false
+	}
+
+	for _, prefix := range outputParams {
+		if key == prefix || strings.HasPrefix(key, prefix+"-") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withOutputParams runs fn with the output params overridden by the supplied values. The output
+// helpers read their params from viper, so the values are set for the duration of the call and
+// then restored. Viper cannot unset a key, so keys that were unset and have no default are left
+// with the override rather than restored to nil (listener output keys are checked against the
+// registered output params, which all have a default). This is only safe because viper is not read
+// concurrently once the listeners are running (all writes to the outputs happen on the event loop).
+func withOutputParams(values map[string]interface{}, fn func() error) error {
+	previous := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		// Record the previous value of keys that are set or have a default
+		if viper.IsSet(key) || viper.Get(key) != nil {
+			previous[key] = viper.Get(key)
+		}
+		viper.Set(key, value)
+	}
+
+	defer func() {
+		for key, value := range previous {
+			viper.Set(key, value)
+		}
+	}()
+
+	return fn()
+}
+
+// streamServer accepts connections on a stream listener and serves each on its own goroutine
+type streamServer struct {
+	listener net.Listener
+	serve    func(conn net.Conn)
+	lock     sync.Mutex
+	conns    map[net.Conn]bool
+	closing  bool
+	wait     sync.WaitGroup
+}
+
+// startStreamServer accepts connections on the listener until killed
+func startStreamServer(listener net.Listener, serve func(conn net.Conn)) *streamServer {
+	s := &streamServer{listener: listener, serve: serve, conns: make(map[net.Conn]bool)}
+
+	s.wait.Add(1)
+	go s.accept()
+
+	return s
+}
+
+// shutdownGrace is the time open connections are given on shutdown to finish the message in progress
+const shutdownGrace = 500 * time.Millisecond
+
+// Kill stops accepting connections and stops reading from open connections once the shutdown grace
+// period has passed, leaving them to finish the message in progress. Frames still incomplete after
+// the grace period are discarded.
+func (s *streamServer) Kill() error {
+	s.lock.Lock()
+	s.closing = true
+	for conn := range s.conns {
+		_ = conn.SetReadDeadline(time.Now().Add(shutdownGrace))
+	}
+	s.lock.Unlock()
+
+	return s.listener.Close()
+}
+
+// Wait until all connections are closed
+func (s *streamServer) Wait() {
+	s.wait.Wait()
+}
+
+func (s *streamServer) accept() {
+	defer s.wait.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+
+		// Handle errors
+		if err != nil {
+			if s.isClosing() {
+				return
+			}
+			log.Errorf("unable to accept connection on %s: %v", s.listener.Addr(), err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		if !s.track(conn) {
+			conn.Close()
+			return
+		}
+
+		s.wait.Add(1)
+		go func() {
+			defer s.wait.Done()
+			defer s.untrack(conn)
+			defer conn.Close()
+
+			s.serve(conn)
+		}()
+	}
+}
+
+func (s *streamServer) isClosing() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.closing
+}
+
+// track records the connection so it can be stopped on shutdown. Returns false when shutting down.
+func (s *streamServer) track(conn net.Conn) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closing {
+		return false
+	}
+	s.conns[conn] = true
+	return true
+}
+
+func (s *streamServer) untrack(conn net.Conn) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.conns, conn)
+}
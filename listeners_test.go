@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"github.com/rfizzle/collector-helpers/outputs"
+	flag "github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"testing"
+)
+
+func TestListenerConfigs(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	viper.Set("ip", "127.0.0.1")
+	viper.Set("port", 1514)
+	viper.Set("protocol", "tcp")
+	viper.Set("tcp-framing", "newline")
+	viper.Set("tcp-frame-delimiter", `\0`)
+	viper.Set("socket-mode", "0660")
+
+	configs, err := listenerConfigs()
+
+	if err != nil {
+		t.Fatalf("failed to read listener configs: %v", err)
+	}
+
+	if len(configs) != 1 || configs[0].Name != "" || configs[0].IP != "127.0.0.1" || configs[0].Port != 1514 || configs[0].Protocol != "tcp" || configs[0].Framing != "newline" {
+		t.Errorf("listenerConfigs() got %+v; expected a single listener from the global params", configs)
+	}
+
+	viper.Set("listeners", []interface{}{
+		map[string]interface{}{"name": "firewall", "port": 1515, "protocol": "udp", "outputs": map[string]interface{}{"s3-bucket": "firewall"}},
+		map[string]interface{}{"name": "app", "protocol": "unix", "socket-path": "/tmp/app.sock", "tcp-framing": "octet-counting", "socket-mode": "0600"},
+	})
+
+	configs, err = listenerConfigs()
+
+	if err != nil {
+		t.Fatalf("failed to read listener configs: %v", err)
+	}
+
+	if len(configs) != 2 {
+		t.Fatalf("listenerConfigs() got %d listeners; expected 2", len(configs))
+	}
+
+	tests := []struct {
+		name     string
+		actual   string
+		expected string
+	}{
+		{"firewall framing", configs[0].Framing, "newline"},
+		{"firewall socket mode", configs[0].SocketMode, "0660"},
+		{"firewall output", configs[0].Outputs["s3-bucket"].(string), "firewall"},
+		{"app framing", configs[1].Framing, "octet-counting"},
+		{"app frame delimiter", configs[1].FrameDelimiter, `\0`},
+		{"app socket path", configs[1].SocketPath, "/tmp/app.sock"},
+		{"app socket mode", configs[1].SocketMode, "0600"},
+	}
+
+	for _, test := range tests {
+		if test.actual != test.expected {
+			t.Errorf("%s got %s; expected %s", test.name, test.actual, test.expected)
+		}
+	}
+
+	viper.Set("listeners", []interface{}{})
+
+	if _, err := listenerConfigs(); err == nil {
+		t.Errorf("failed to error on empty listeners param")
+	}
+}
+
+func TestSinkFor(t *testing.T) {
+	defaultSink, firewallSink := &sink{}, &sink{}
+	sinks := map[string]*sink{"": defaultSink, "firewall": firewallSink}
+
+	tests := []struct {
+		logParts map[string]interface{}
+		expected *sink
+	}{
+		{map[string]interface{}{"listener": "firewall"}, firewallSink},
+		{map[string]interface{}{"listener": "app"}, defaultSink},
+		{map[string]interface{}{}, defaultSink},
+	}
+
+	for _, test := range tests {
+		if s := sinkFor(sinks, test.logParts); s != test.expected {
+			t.Errorf("sinkFor(%v) got %p; expected %p", test.logParts, s, test.expected)
+		}
+	}
+}
+
+func TestIsOutputParam(t *testing.T) {
+	if flag.Lookup("s3-bucket") == nil {
+		outputs.InitCLIParams()
+	}
+
+	tests := []struct {
+		key      string
+		expected bool
+	}{
+		{"s3", true},
+		{"s3-bucket", true},
+		{"http-url", true},
+		{"s3-buckt", false},
+		{"http-ulr", false},
+		{"parser", false},
+	}
+
+	for _, test := range tests {
+		if result := isOutputParam(test.key); result != test.expected {
+			t.Errorf("isOutputParam(%s) got %v; expected %v", test.key, result, test.expected)
+		}
+	}
+}
+
+func TestWithOutputParams(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	viper.Set("s3-bucket", "global")
+	viper.SetDefault("http-url", "http://global")
+
+	err := withOutputParams(map[string]interface{}{"s3-bucket": "firewall", "http-url": "http://firewall"}, func() error {
+		if viper.GetString("s3-bucket") != "firewall" || viper.GetString("http-url") != "http://firewall" {
+			t.Errorf("withOutputParams() got %s, %s; expected the listener outputs", viper.GetString("s3-bucket"), viper.GetString("http-url"))
+		}
+		return errors.New("output failed")
+	})
+
+	if err == nil || err.Error() != "output failed" {
+		t.Errorf("withOutputParams() got %v; expected the error of fn", err)
+	}
+
+	if viper.GetString("s3-bucket") != "global" {
+		t.Errorf(`viper.GetString("s3-bucket") got %s; expected %s`, viper.GetString("s3-bucket"), "global")
+	}
+
+	if viper.GetString("http-url") != "http://global" {
+		t.Errorf(`viper.GetString("http-url") got %s; expected %s`, viper.GetString("http-url"), "http://global")
+	}
+}
@@ -1,8 +1,8 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
-	"fmt"
 	"github.com/rfizzle/collector-helpers/outputs"
 	"github.com/rfizzle/syslog-collector/parser"
 	log "github.com/sirupsen/logrus"
@@ -38,250 +38,390 @@ func main() {
 	// Setup the rotation time
 	rotationTime := viper.GetInt("schedule")
 
+	// Setup parsers and routing rules
+	logRouter, err := newRouter()
+	if err != nil {
+		log.Errorf("unable to setup parser: %v", err)
+		os.Exit(1)
+	}
+
+	// Get listeners
+	listeners, err := listenerConfigs()
+	if err != nil {
+		log.Errorf("%v", err.Error())
+		os.Exit(1)
+	}
+
 	// Setup Channel
 	channel := make(syslog.LogPartsChannel)
-	handler := syslog.NewChannelHandler(channel)
-
-	// Setup syslog server
-	server := syslog.NewServer()
-	server.SetFormat(syslog.Automatic)
-	server.SetHandler(handler)
-
-	// Get address from supplied parameters
-	setAddress := fmt.Sprintf("%s:%d", viper.GetString("ip"), viper.GetInt("port"))
-
-	// Setup TCP listener
-	if viper.GetString("protocol") == "tcp" || viper.GetString("protocol") == "both" {
-		log.Infof("listening on %s/%s", setAddress, "TCP")
-		if err := server.ListenTCP(setAddress); err != nil {
-			log.Errorf("unable to start TCP listener on %s", setAddress)
-			os.Exit(1)
-		}
-	}
 
-	// Setup UDP listener
-	if viper.GetString("protocol") == "udp" || viper.GetString("protocol") == "both" {
-		log.Infof("listening on %s/%s", setAddress, "UDP")
-		if err := server.ListenUDP(setAddress); err != nil {
-			log.Errorf("unable to start UDP listener on %s", setAddress)
-			os.Exit(1)
-		}
+	// Setup syslog servers
+	servers, err := startListeners(listeners, channel)
+	if err != nil {
+		log.Errorf("%v", err.Error())
+		os.Exit(1)
 	}
 
-	// Boot up server
-	if err := server.Boot(); err != nil {
-		log.Errorf("unable to boot syslog service: %v", err.Error())
+	// Setup log writers (one for the global outputs and one for each listener with its own outputs)
+	sinks, err := setupSinks(rotationTime, listeners)
+	if err != nil {
+		log.Errorf("%v", err.Error())
 		os.Exit(1)
 	}
 
-	// Setup log writer
-	tmpWriter, err := outputs.NewTmpWriter()
+	// Setup dead-letter writer
+	deadLetters, err := newDeadLetterWriter()
 	if err != nil {
 		log.Errorf("%v", err.Error())
 		os.Exit(1)
 	}
 
 	// Soft close when CTRL + C is called
-	done := setupCloseHandler(tmpWriter, server, channel)
+	quit := make(chan bool)
+	finished := make(chan bool)
+	done := setupCloseHandler(servers, quit, finished)
 
 	// Run go routine
-	go getEvents(rotationTime, channel, tmpWriter)
-
-	// Infinite wait while server is running
-	server.Wait()
+	go func() {
+		getEvents(channel, quit, sinks, deadLetters, logRouter)
+		close(finished)
+	}()
 
 	// Wait until closed successfully
 	<-done
 }
 
+// setupSinks creates the default sink for the global outputs and a sink for each listener with its
+// own outputs, keyed by listener name
+func setupSinks(rotationTime int, listeners []listenerConfig) (map[string]*sink, error) {
+	defaultSink, err := newSink(rotationTime, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sinks := map[string]*sink{"": defaultSink}
+	for _, l := range listeners {
+		if len(l.Outputs) == 0 {
+			continue
+		}
+
+		s, err := newSink(rotationTime, l.Outputs)
+		if err != nil {
+			return nil, err
+		}
+		sinks[l.Name] = s
+	}
+
+	return sinks, nil
+}
+
+// sinkFor returns the sink for the listener that received the event
+func sinkFor(sinks map[string]*sink, logParts map[string]interface{}) *sink {
+	if name, ok := logParts["listener"].(string); ok {
+		if s, ok := sinks[name]; ok {
+			return s
+		}
+	}
+
+	return sinks[""]
+}
+
 // Get events
-func getEvents(rotationTime int, channel syslog.LogPartsChannel, tmpWriter *outputs.TmpWriter) {
-	// Setup required variables
-	var err error
-	var jsonString []byte
-	count := 0
-	timestamp := time.Now()
-
-	// Loop through channel
-	for logParts := range channel {
-		// Rotate file and output if set duration has passed
-		if time.Now().After(timestamp.Add(time.Duration(rotationTime) * time.Second)) && count > 0 {
-			// Rotate temp file
-			_ = tmpWriter.Rotate()
-
-			// Print verbose
-			if viper.GetBool("verbose") {
-				log.Debugf("temporary log file written to: %v", tmpWriter.LastFilePath)
+func getEvents(channel syslog.LogPartsChannel, quit chan bool, sinks map[string]*sink, deadLetters *deadLetterWriter, r *router) {
+	// Check the schedule every second so quiet sources are still shipped on time
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	// Loop through channel until shutdown
+	for {
+		select {
+		case logParts := <-channel:
+			// Parse and write the event, and the events waiting behind it, to the tmp logs
+			receiveEvents(logParts, channel, sinks, deadLetters, r)
+		case <-ticker.C:
+			// Rotate file and output if set duration has passed
+			for _, s := range sinks {
+				if s.batch.expired() {
+					rotateBatch(s, deadLetters)
+				}
+			}
+		case <-quit:
+			// Drain messages still waiting on the channel
+			drainEvents(channel, sinks, deadLetters, r)
+
+			// Ship the final batches
+			for _, s := range sinks {
+				flushFinalBatch(s, deadLetters)
 			}
 
-			// Write to outputs
-			if err := outputs.WriteToOutputs(tmpWriter.LastFilePath, timestamp.Format(time.RFC3339)); err != nil {
-				log.Errorf("unable to write to output: %v", err)
-				log.Errorf("temporary file: %s", tmpWriter.LastFilePath)
+			// Close the dead-letter writer
+			log.Debugf("closing dead-letter writer...")
+			if err := deadLetters.Close(); err != nil {
 				log.Errorf("%v", err)
 			}
+			return
+		}
+	}
+}
 
-			// Let know that event has been processes
-			log.Infof("%v events processed...", count)
+// maxReceiveEvents bounds the number of events handled by the event loop between syncs of the tmp logs
+const maxReceiveEvents = 1024
 
-			// Update limit count
-			timestamp = time.Now()
-			count = 0
+// receiveEvents handles the event and any events already waiting on the channel, shipping batches
+// that reach their limits. RELP events are acknowledged together once the tmp logs they were written
+// to have been synced, so a burst of RELP events costs a single sync per tmp log.
+func receiveEvents(logParts map[string]interface{}, channel syslog.LogPartsChannel, sinks map[string]*sink, deadLetters *deadLetterWriter, r *router) {
+	acks := &relpAcks{}
 
-			// Remove temp file now
-			err := os.Remove(tmpWriter.LastFilePath)
-			if err != nil {
-				log.Errorf("unable to remove tmp file: %v", err)
+	for i := 0; logParts != nil; i++ {
+		s := handleEvent(logParts, sinks, deadLetters, r, acks)
+
+		// Ship bursts early once the batch limits are reached (after syncing what was acknowledged)
+		if s.batch.full() {
+			acks.flush(deadLetters)
+			rotateBatch(s, deadLetters)
+		}
+
+		// Take the next waiting event
+		logParts = nil
+		if i < maxReceiveEvents {
+			select {
+			case logParts = <-channel:
+			default:
 			}
 		}
+	}
 
-		// Define log message
-		var logMessage string
+	acks.flush(deadLetters)
+}
 
-		// Check all syslog types
-		if logParts["content"] == nil && logParts["message"] == nil {
-			continue
-		}
+// handleEvent writes the event to the tmp log of its sink and adds it to the batch. Returns the sink.
+// Acknowledgements of RELP events are added to acks.
+func handleEvent(logParts map[string]interface{}, sinks map[string]*sink, deadLetters *deadLetterWriter, r *router, acks *relpAcks) *sink {
+	ack := takeRelpAck(logParts)
+	s := sinkFor(sinks, logParts)
 
-		// Get message from syslog struct (map key depends on format)
-		if logParts["content"] != nil {
-			logMessage = logParts["content"].(string)
-		} else {
-			logMessage = logParts["message"].(string)
-		}
+	size, err := processEvent(logParts, s.tmpWriter, deadLetters, r)
+	if size > 0 {
+		s.batch.add(size)
+	}
 
-		// Parse content
-		if viper.GetString("parser") == "grok" {
-			// Construct JSON from GROK patterns
-			jsonString, err = parser.ParseGrok(logMessage, viper.GetStringSlice("grok-pattern"))
+	if ack != nil {
+		acks.add(ack, s, size > 0, err)
+	}
 
-			// Handle errors in grok parsing
-			if err != nil {
-				log.Warnf("unable to marshal map to JSON: %v", err)
-				continue
-			}
-		} else if viper.GetString("parser") == "json" {
-			// Construct JSON from raw message
-			jsonString, err = parser.ParseJson(logMessage)
+	return s
+}
 
-			// Handle errors in JSON parsing
-			if err != nil {
-				log.Warnf("unable to parse json message: %v", err)
-				continue
-			}
-		} else if viper.GetString("parser") == "kv" {
-			// Construct JSON from KV string
-			jsonString, err = parser.ParseKV(logMessage)
+// processEvent parses the syslog event and writes the result to the tmp log. Returns the number
+// of bytes written, or 0 if the event was skipped, and an error if the tmp log or dead-letter could
+// not be written.
+func processEvent(logParts map[string]interface{}, tmpWriter *outputs.TmpWriter, deadLetters *deadLetterWriter, r *router) (int, error) {
+	// Define log message
+	var logMessage string
 
-			// Handle errors in KV parsing
-			if err != nil {
-				log.Warnf("unable to parse kv message: %v", err)
-				continue
-			}
-		} else if viper.GetString("parser") == "cef" {
-			// Construct JSON from CEF string
-			jsonString, err = parser.ParseCef(logMessage)
+	// Check all syslog types
+	if logParts["content"] == nil && logParts["message"] == nil {
+		return 0, nil
+	}
 
-			// Handle errors in CEF parsing
-			if err != nil {
-				log.Warnf("unable to parse cef message: %v", err)
-				continue
-			}
-		} else if viper.GetString("parser") == "raw" {
-			jsonString, err = json.Marshal(logParts)
+	// Get message from syslog struct (map key depends on format)
+	if logParts["content"] != nil {
+		logMessage = logParts["content"].(string)
+	} else {
+		logMessage = logParts["message"].(string)
+	}
 
-			// Handle errors in RAW parsing
-			if err != nil {
-				log.Warnf("unable to parse raw message: %v", err)
-				continue
-			}
+	// Decode RFC 5424 structured data into a nested object keyed by SD-ID
+	if sd, ok := logParts["structured_data"].(string); ok && viper.GetBool("decode-structured-data") {
+		if sdObj, err := parser.ParseStructuredData(sd); err == nil {
+			logParts["structured_data"] = sdObj
+		} else {
+			log.Debugf("unable to decode structured data: %v", err)
 		}
+	}
 
-		if viper.GetString("parser") != "raw" && viper.GetBool("keep-syslog") {
-			// Merge message and syslog info
-			finalJsonMap := make(map[string]interface{})
-			err = json.Unmarshal(jsonString, &finalJsonMap)
+	// Select the parser chain from the routing rules
+	routeName, p := r.route(logParts, logMessage)
 
-			// Handle errors in unmarshal
-			if err != nil {
-				log.Warnf("unable to unmarshal json results: %v", err)
-				continue
-			}
+	// Parse content (first parser in the chain to succeed wins)
+	jsonString, parserName, err := p.ParseWithName(logMessage, logParts)
 
-			// Loop through syslog info and add to final json object
-			for k, v := range logParts {
-				if (k == "message" || k == "content") && !viper.GetBool("keep-message") {
-					continue
-				}
-				finalJsonMap[k] = v
-			}
+	// Handle errors in parsing
+	if err != nil {
+		log.Warnf("unable to parse %s message: %v", p.Name(), err)
+
+		// Keep failed message for inspection and replay
+		return deadLetterEvent(deadLetters, logMessage, logParts, p.Name(), err)
+	}
 
-			jsonString, err = json.Marshal(finalJsonMap)
+	// Handle null parse results
+	if jsonString == nil {
+		log.Error("parse result for syslog message resulted in nil object")
+		return 0, nil
+	}
 
-			if err != nil {
-				log.Errorf("error marshalling final json: %v", err)
+	// Collect the fields to add to the parse result
+	fields := make(map[string]interface{})
+
+	// Record the winning parser when falling back through several
+	if p.Len() > 1 {
+		fields["parser"] = parserName
+	}
+
+	// Record the route that selected the parser
+	if r.hasRoutes() {
+		fields["route"] = routeName
+	}
+
+	if parserName != "raw" && viper.GetBool("keep-syslog") {
+		// Merge message and syslog info
+		for k, v := range logParts {
+			if (k == "message" || k == "content") && !viper.GetBool("keep-message") {
 				continue
 			}
+			fields[k] = v
+		}
+	} else if parserName != "raw" {
+		// Record the listener, its tags, the TLS peer certificate subject and the unix socket peer
+		// credentials when syslog info is not already merged
+		for _, key := range []string{"listener", "tags", "tls_peer", "peer_pid", "peer_uid", "peer_gid"} {
+			if value, ok := logParts[key]; ok && value != nil && value != "" {
+				fields[key] = value
+			}
 		}
+	}
 
-		// Handle null parse results
-		if jsonString == nil {
-			log.Error("parse result for syslog message resulted in nil object")
-			continue
+	if len(fields) > 0 {
+		jsonString, err = addJsonFields(jsonString, fields)
+
+		if err != nil {
+			log.Errorf("error adding fields to json: %v", err)
+			return deadLetterEvent(deadLetters, logMessage, logParts, parserName, err)
 		}
+	}
 
-		// Write to tmp log
-		if err :=  tmpWriter.WriteLog(string(pretty.Ugly(jsonString))); err != nil {
-			log.Errorf("unable to write log: %v", err)
-			continue
+	// Write to tmp log
+	line := string(pretty.Ugly(jsonString))
+	if err := tmpWriter.WriteLog(line); err != nil {
+		log.Errorf("unable to write log: %v", err)
+		return 0, err
+	}
+
+	return len(line) + 1, nil
+}
+
+// deadLetterEvent records a message that could not be processed to the dead-letters. Returns an error
+// if the dead-letter could not be written.
+func deadLetterEvent(deadLetters *deadLetterWriter, logMessage string, logParts map[string]interface{}, parserName string, err error) (int, error) {
+	if err := deadLetters.Write(logMessage, logParts, parserName, err); err != nil {
+		log.Errorf("unable to write dead-letter: %v", err)
+		return 0, err
+	}
+
+	return 0, nil
+}
+
+// drainEvents processes the events still waiting on the channel without blocking and adds them
+// to the batch of their sink.
+func drainEvents(channel syslog.LogPartsChannel, sinks map[string]*sink, deadLetters *deadLetterWriter, r *router) {
+	for {
+		select {
+		case logParts := <-channel:
+			receiveEvents(logParts, channel, sinks, deadLetters, r)
+		default:
+			return
 		}
+	}
+}
 
-		// Increment count to prevent rotating on empty
-		count += 1
+// addJsonFields sets top level fields on a marshalled JSON object. Numbers are kept as they were
+// written so large integers are not rounded.
+func addJsonFields(jsonString []byte, fields map[string]interface{}) ([]byte, error) {
+	jsonMap := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(jsonString))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&jsonMap); err != nil {
+		return nil, err
+	}
+
+	for key, value := range fields {
+		jsonMap[key] = value
 	}
 
+	return json.Marshal(jsonMap)
 }
 
 // SetupCloseHandler creates a 'listener' on a new goroutine which will notify the
-// program if it receives an interrupt from the OS. We then handle this by calling
-// our clean up procedure and exiting the program.
-func setupCloseHandler(w *outputs.TmpWriter, s *syslog.Server, channel syslog.LogPartsChannel) chan bool {
+// program if it receives an interrupt from the OS. We then handle this by stopping the
+// syslog servers, telling the event loop to drain and ship the final batch, and waiting
+// for it to finish (bounded by the shutdown timeout).
+func setupCloseHandler(servers []listenerServer, quit chan bool, finished chan bool) chan bool {
+	// Read the timeout now as viper is not safe to read alongside the event loop
+	timeout := time.Duration(viper.GetInt("shutdown-timeout")) * time.Second
+
 	done := make(chan bool)
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-c
 		log.Infof("received SIGTERM...")
 
-		// Kill syslog service
-		log.Debugf("shutting down syslog service...")
+		if shutdown(servers, quit, finished, timeout) {
+			log.Infof("shutdown successful...")
+		}
+
+		done <- true
+	}()
+
+	return done
+}
+
+// shutdown stops the syslog servers and tells the event loop to drain and ship the final batch.
+// Waiting for the servers and waiting for the final batch are each bounded by the timeout, so
+// listeners that are slow to stop never eat into the time left to ship the final batch. Returns
+// whether the final batch was written in time.
+func shutdown(servers []listenerServer, quit chan bool, finished chan bool, timeout time.Duration) bool {
+	// Kill syslog service
+	log.Debugf("shutting down syslog service...")
+	for _, s := range servers {
 		if err := s.Kill(); err != nil {
 			log.Errorf("error closing syslog server: %v", err)
 		}
+	}
 
-		// Wait until all data has been written
-		log.Debugf("waiting for channel to be clear...")
-		for len(channel) > 0 {
-			<-time.After(time.Duration(1) * time.Second)
+	// Wait until the listeners have handed off all received messages
+	log.Debugf("waiting for syslog service to stop...")
+	stopped := make(chan bool)
+	go func() {
+		for _, s := range servers {
+			s.Wait()
 		}
+		close(stopped)
+	}()
 
-		// Close the temp file
-		log.Debugf("closing temp file...")
-		if err := w.Close(); err != nil {
-			log.Errorf("Error closing log file: %v", err)
-		}
+	stopDeadline := time.NewTimer(timeout)
+	defer stopDeadline.Stop()
 
-		// Remove temp file now
-		log.Debugf("removing temp file...")
-		err := os.Remove(w.LastFilePath)
-		if err != nil {
-			log.Errorf("Unable to remove tmp file: %v", err)
-		}
+	select {
+	case <-stopped:
+	case <-stopDeadline.C:
+		log.Warnf("syslog service did not stop before shutdown deadline")
+	}
 
-		// Print success and write to channel
-		log.Infof("shutdown successful...")
-		done<-true
-	}()
+	// Drain the channel and ship the final batch
+	log.Debugf("flushing final batch...")
+	close(quit)
 
-	return done
-}
\ No newline at end of file
+	flushDeadline := time.NewTimer(timeout)
+	defer flushDeadline.Stop()
+
+	select {
+	case <-finished:
+		return true
+	case <-flushDeadline.C:
+		log.Errorf("shutdown deadline exceeded before final batch was written")
+		return false
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestAddJsonFields(t *testing.T) {
+	tests := []struct {
+		json     string
+		fields   map[string]interface{}
+		expected string
+	}{
+		{`{"id":1234567890123456789}`, map[string]interface{}{"parser": "json"}, `{"id":1234567890123456789,"parser":"json"}`},
+		{`{"amount":1.50,"parser":"old"}`, map[string]interface{}{"parser": "kv", "route": "firewall"}, `{"amount":1.50,"parser":"kv","route":"firewall"}`},
+		{`{}`, map[string]interface{}{"tags": []string{"prod"}, "peer_pid": 42}, `{"peer_pid":42,"tags":["prod"]}`},
+	}
+
+	for _, test := range tests {
+		result, err := addJsonFields([]byte(test.json), test.fields)
+		if err != nil {
+			t.Errorf("addJsonFields(%s) failed: %v", test.json, err)
+		} else if string(result) != test.expected {
+			t.Errorf("addJsonFields(%s) got %s; expected %s", test.json, result, test.expected)
+		}
+	}
+
+	for _, value := range []string{`[1,2]`, `not json`, ``} {
+		if _, err := addJsonFields([]byte(value), map[string]interface{}{"parser": "json"}); err == nil {
+			t.Errorf("addJsonFields(%q) failed to error on a non-object", value)
+		}
+	}
+}
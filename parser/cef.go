@@ -5,8 +5,6 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
-
-	"github.com/dlclark/regexp2"
 )
 
 type CefEvent struct {
@@ -18,91 +16,94 @@ type CefEvent struct {
 	Name               string
 	Severity           string
 	Extensions         map[string]string
+	Prefix             string `json:",omitempty"`
 }
 
-func ParseCef(event string) ([]byte, error) {
-	cefEvent, err := cefStringToObject(event)
+func init() {
+	Register("cef", func(config *Config) (Parser, error) {
+		return &CefParser{expandKeys: config.CefExpandKeys, stringValues: config.CefStringValues}, nil
+	})
+}
+
+// typedCefEvent is a CefEvent with the Severity and extension values converted to their CEF data types
+type typedCefEvent struct {
+	*CefEvent
+	Severity   interface{}
+	Extensions map[string]interface{}
+}
+
+// CefParser parses CEF messages with optional extension key expansion and value conversion
+type CefParser struct {
+	expandKeys   bool
+	stringValues bool
+}
+
+func (p *CefParser) Name() string {
+	return "cef"
+}
+
+func (p *CefParser) Parse(message string, _ map[string]interface{}) ([]byte, error) {
+	cefEvent, err := cefStringToObject(message)
 
 	if err != nil {
 		return nil, err
 	}
 
-	// Marshal JSON string
-	jsonString, err := json.Marshal(cefEvent)
+	event := &typedCefEvent{CefEvent: cefEvent}
 
-	// Handle errors
-	if err != nil {
-		fmt.Println(3)
-		return nil, err
+	// Convert known dictionary fields to their data types unless strict string passthrough is set
+	if p.stringValues {
+		event.Severity = cefEvent.Severity
+		event.Extensions = make(map[string]interface{}, len(cefEvent.Extensions))
+		for k, v := range cefEvent.Extensions {
+			event.Extensions[k] = v
+		}
+	} else {
+		event.Severity = convertCefSeverity(cefEvent.Severity)
+		event.Extensions = convertCefExtensions(cefEvent.Extensions)
+	}
+
+	// Map extension keys to their full dictionary names and collapse label pairs
+	if p.expandKeys {
+		event.Extensions = expandCefExtensions(event.Extensions)
 	}
 
-	return jsonString, nil
+	// Marshal JSON string
+	return json.Marshal(event)
+}
+
+// ParseCef converts the CEF message to JSON with the known extension values converted to their
+// CEF data types
+func ParseCef(event string) ([]byte, error) {
+	return (&CefParser{}).Parse(event, nil)
 }
 
 func cefStringToObject(cefString string) (*CefEvent, error) {
-	// Split by CEF separator
-	arr := strings.Split(cefString, "|")
+	// Locate the CEF header, which may follow a syslog header or program tag
+	prefix, cefString := cefSplitPrefix(cefString)
+
+	// Split header fields (CEF:Version|Vendor|Product|Version|SignatureID|Name|Severity|Extensions)
+	arr := splitHeader(cefString, 7)
 
 	if len(arr) < 8 {
 		return nil, fmt.Errorf("invalid CEF format")
 	}
 
-	version := ""
-
-	if strings.Contains(arr[0], ":") {
-		// Split first field to validate CEF
-		validate := strings.Split(arr[0], ":")
+	// Validate the version (a bare version when the CEF: marker was consumed as the syslog tag)
+	version := strings.TrimPrefix(arr[0], "CEF:")
 
-		// Validate that it is a valid CEF message
-		if validate[0] != "CEF" {
-			return nil, fmt.Errorf("invalid CEF format")
-		}
-
-		version = validate[1]
-	} else {
-		if _, err := strconv.Atoi(arr[0]); err != nil {
-			return nil, fmt.Errorf("invalid CEF format")
-		}
-		version = arr[0]
+	if _, err := strconv.Atoi(version); err != nil {
+		return nil, fmt.Errorf("invalid CEF format")
 	}
 
-	// Get extensions
-	extensions := strings.Join(arr[7:], "|")
-
-	// Replace colons with {{COLON}}
-	safeExtensions := strings.ReplaceAll(extensions, ":", "{{COLON}}")
-	safeExtensions = strings.ReplaceAll(safeExtensions, `\\=`, "{{EQUAL_ESCAPE_2}}")
-	safeExtensions = strings.ReplaceAll(safeExtensions, `\=`, "{{EQUAL_ESCAPE_1}}")
-
-	// Replace non KV spaces with {{SPACE}}
-	re := regexp2.MustCompile(`\s(?![a-z0-9A-Z]+\=)`, 0)
-	safeExtensions2, err := re.Replace(safeExtensions, "{{SPACE}}", -1, -1)
-
 	// Parse extensions in key value format
-	keyValueMap, err := parseKeyValue(safeExtensions2, true)
+	extensions, err := parseCefExtensions(arr[7])
 
 	// Handle error
 	if err != nil {
 		return nil, err
 	}
 
-	// Restore colons
-	newKeyValueMap := make(map[string]string, 0)
-	for k, v := range keyValueMap {
-		newKey := strings.ReplaceAll(k, `{{SPACE}}`, " ")
-		newKey = strings.ReplaceAll(newKey, `{{EQUAL_ESCAPE_1}}`, `\=`)
-		newKey = strings.ReplaceAll(newKey, `{{EQUAL_ESCAPE_2}}`, `\\=`)
-		newKey = strings.ReplaceAll(newKey, `{{COLON}}`, ":")
-
-		newValue := strings.ReplaceAll(v, `{{SPACE}}`, " ")
-		newValue = strings.ReplaceAll(newValue, `{{EQUAL_ESCAPE_1}}`, `\=`)
-		newValue = strings.ReplaceAll(newValue, `{{EQUAL_ESCAPE_2}}`, `\\=`)
-		newValue = strings.ReplaceAll(newValue, `{{COLON}}`, ":")
-		newValue = strings.TrimSpace(newValue)
-
-		newKeyValueMap[newKey] = newValue
-	}
-
 	// Build CEF event
 	cefEvent := &CefEvent{
 		Version:            version,
@@ -112,14 +113,131 @@ func cefStringToObject(cefString string) (*CefEvent, error) {
 		DeviceEventClassId: cefEscapeField(arr[4]),
 		Name:               cefEscapeField(arr[5]),
 		Severity:           cefEscapeField(arr[6]),
-		Extensions:         newKeyValueMap,
+		Extensions:         extensions,
+		Prefix:             prefix,
 	}
 
 	return cefEvent, nil
 }
 
+// splitHeader splits the first count pipe delimited CEF/LEEF header fields (respecting escaped pipes)
+// and returns them followed by the remainder of the string.
+func splitHeader(s string, count int) []string {
+	fields := make([]string, 0, count+1)
+	start := 0
+
+	for i := 0; i < len(s) && len(fields) < count; i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == '|' {
+			fields = append(fields, s[start:i])
+			start = i + 1
+		}
+	}
+
+	if len(fields) == count {
+		fields = append(fields, s[start:])
+	}
+
+	return fields
+}
+
+// cefSplitPrefix locates the first CEF:Version| marker in the message and returns the trimmed text
+// before it (a syslog header or program tag) and the CEF message from the marker onwards. Messages
+// without a marker are returned unchanged.
+func cefSplitPrefix(message string) (string, string) {
+	for offset := 0; offset < len(message); {
+		i := strings.Index(message[offset:], "CEF:")
+
+		if i < 0 {
+			break
+		}
+
+		i += offset
+		offset = i + len("CEF:")
+
+		// The marker must be followed by a numeric version and a pipe
+		digits := offset
+		for digits < len(message) && message[digits] >= '0' && message[digits] <= '9' {
+			digits++
+		}
+
+		if digits > offset && digits < len(message) && message[digits] == '|' {
+			return strings.TrimSpace(message[:i]), message[i:]
+		}
+	}
+
+	return "", message
+}
+
+// parseCefExtensions scans the space separated key=value CEF extensions in a single pass. A key is a
+// run of letters, digits, underscores, dots and dashes that follows a space and precedes an unescaped
+// equals sign; any other equals sign, space or pipe belongs to the current value. Values are trimmed
+// and unescaped (\\, \=, \n and \r).
+func parseCefExtensions(extensions string) (map[string]string, error) {
+	extensionMap := make(map[string]string)
+
+	// Leading key
+	start := 0
+	for start < len(extensions) && extensions[start] == ' ' {
+		start++
+	}
+
+	if start == len(extensions) {
+		return extensionMap, nil
+	}
+
+	end := start
+	for end < len(extensions) && isCefKeyChar(extensions[end]) {
+		end++
+	}
+
+	if end == start || end == len(extensions) || extensions[end] != '=' {
+		return nil, fmt.Errorf(`invalid CEF extension format at: "%s"`, extensions[start:])
+	}
+
+	key := extensions[start:end]
+	valueStart := end + 1
+
+	for i := valueStart; i < len(extensions); i++ {
+		switch extensions[i] {
+		case '\\':
+			// Skip the escaped character
+			i++
+		case '=':
+			// Walk back over the candidate key, which must follow a space
+			keyStart := i
+			for keyStart > valueStart && isCefKeyChar(extensions[keyStart-1]) {
+				keyStart--
+			}
+
+			if keyStart == i || keyStart == valueStart || extensions[keyStart-1] != ' ' {
+				continue
+			}
+
+			extensionMap[key] = cefUnescapeExtension(strings.TrimSpace(extensions[valueStart : keyStart-1]))
+			key = extensions[keyStart:i]
+			valueStart = i + 1
+		}
+	}
+
+	extensionMap[key] = cefUnescapeExtension(strings.TrimSpace(extensions[valueStart:]))
+
+	return extensionMap, nil
+}
+
+// isCefKeyChar reports whether c may be part of a CEF extension key
+func isCefKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-'
+}
+
 // Unescape CEF fields
 func cefEscapeField(field string) string {
+	if !strings.Contains(field, "\\") {
+		return field
+	}
 
 	replacer := strings.NewReplacer(
 		"\\\\", "\\",
@@ -130,14 +248,18 @@ func cefEscapeField(field string) string {
 	return replacer.Replace(field)
 }
 
-// Unescape CEF extensions
-func cefEscapeExtension(field string) string {
+// Unescape CEF extension values
+func cefUnescapeExtension(value string) string {
+	if !strings.Contains(value, "\\") {
+		return value
+	}
 
 	replacer := strings.NewReplacer(
 		"\\\\", "\\",
-		"\\n", "\n",
 		"\\=", "=",
+		"\\n", "\n",
+		"\\r", "\r",
 	)
 
-	return replacer.Replace(field)
-}
\ No newline at end of file
+	return replacer.Replace(value)
+}
@@ -0,0 +1,137 @@
+package parser
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// cefDictionary maps the ArcSight CEF extension dictionary short key names to their full names.
+// Keys that are already full names in the dictionary are not listed.
+var cefDictionary = map[string]string{
+	"act":     "deviceAction",
+	"agt":     "agentAddress",
+	"ahost":   "agentHostName",
+	"aid":     "agentId",
+	"amac":    "agentMacAddress",
+	"app":     "applicationProtocol",
+	"art":     "agentReceiptTime",
+	"at":      "agentType",
+	"atz":     "agentTimeZone",
+	"av":      "agentVersion",
+	"cat":     "deviceEventCategory",
+	"catdt":   "categoryDeviceType",
+	"cnt":     "baseEventCount",
+	"dhost":   "destinationHostName",
+	"dlat":    "destinationGeoLatitude",
+	"dlong":   "destinationGeoLongitude",
+	"dmac":    "destinationMacAddress",
+	"dntdom":  "destinationNtDomain",
+	"dpid":    "destinationProcessId",
+	"dpriv":   "destinationUserPrivileges",
+	"dproc":   "destinationProcessName",
+	"dpt":     "destinationPort",
+	"dst":     "destinationAddress",
+	"dtz":     "deviceTimeZone",
+	"duid":    "destinationUserId",
+	"duser":   "destinationUserName",
+	"dvc":     "deviceAddress",
+	"dvchost": "deviceHostName",
+	"dvcmac":  "deviceMacAddress",
+	"dvcpid":  "deviceProcessId",
+	"end":     "endTime",
+	"fname":   "fileName",
+	"fsize":   "fileSize",
+	"in":      "bytesIn",
+	"msg":     "message",
+	"out":     "bytesOut",
+	"outcome": "eventOutcome",
+	"proto":   "transportProtocol",
+	"request": "requestUrl",
+	"rt":      "deviceReceiptTime",
+	"shost":   "sourceHostName",
+	"slat":    "sourceGeoLatitude",
+	"slong":   "sourceGeoLongitude",
+	"smac":    "sourceMacAddress",
+	"sntdom":  "sourceNtDomain",
+	"spid":    "sourceProcessId",
+	"spriv":   "sourceUserPrivileges",
+	"sproc":   "sourceProcessName",
+	"spt":     "sourcePort",
+	"src":     "sourceAddress",
+	"start":   "startTime",
+	"suid":    "sourceUserId",
+	"suser":   "sourceUserName",
+}
+
+// cefCustomKey matches the custom extension keys that are paired with a label key
+// (cs1/cs1Label, cn1/cn1Label, cfp1/cfp1Label, c6a1/c6a1Label, deviceCustomDate1, flexString1, ...)
+var cefCustomKey = regexp.MustCompile(`^(cs[1-6]|cn[1-3]|cfp[1-4]|c6a[1-4]|deviceCustomDate[1-2]|flexString[1-2]|flexNumber[1-2]|flexDate1)$`)
+
+// cefShortCustomKey matches the short custom keys and their labels (cs1, cs1Label, ...)
+var cefShortCustomKey = regexp.MustCompile(`^(cs[1-6]|cn[1-3]|cfp[1-4]|c6a[1-4])(Label)?$`)
+
+// cefCustomPrefixes maps the short custom key prefixes to their full names
+var cefCustomPrefixes = map[string]string{
+	"cs":  "deviceCustomString",
+	"cn":  "deviceCustomNumber",
+	"cfp": "deviceCustomFloatingPoint",
+	"c6a": "deviceCustomIPv6Address",
+}
+
+// cefFullKey returns the full dictionary name for a CEF extension key
+func cefFullKey(key string) string {
+	if fullKey, ok := cefDictionary[key]; ok {
+		return fullKey
+	}
+
+	// Custom keys and their labels (cs1 -> deviceCustomString1, cs1Label -> deviceCustomString1Label)
+	if match := cefShortCustomKey.FindStringSubmatch(key); match != nil {
+		prefix, number := match[1][:len(match[1])-1], match[1][len(match[1])-1:]
+		return cefCustomPrefixes[prefix] + number + match[2]
+	}
+
+	return key
+}
+
+// expandCefExtensions maps the extension keys to their full dictionary names and collapses custom
+// key/label pairs (cs1=value cs1Label=name) into a single field named by the label (name=value).
+// Custom keys without a label, or whose label collides with another field, keep their full name.
+func expandCefExtensions(extensions map[string]interface{}) map[string]interface{} {
+	expanded := make(map[string]interface{}, len(extensions))
+	pairs := make([]string, 0)
+
+	for k, v := range extensions {
+		if cefCustomKey.MatchString(k) {
+			if _, ok := extensions[k+"Label"]; ok {
+				pairs = append(pairs, k)
+				continue
+			}
+		}
+
+		if key := strings.TrimSuffix(k, "Label"); key != k && cefCustomKey.MatchString(key) {
+			if _, ok := extensions[key]; ok {
+				continue
+			}
+		}
+
+		expanded[cefFullKey(k)] = v
+	}
+
+	// Sort pairs so label collisions are resolved consistently
+	sort.Strings(pairs)
+
+	for _, k := range pairs {
+		label, _ := extensions[k+"Label"].(string)
+
+		if _, exists := expanded[label]; exists || label == "" {
+			expanded[cefFullKey(k)] = extensions[k]
+			expanded[cefFullKey(k+"Label")] = extensions[k+"Label"]
+			continue
+		}
+
+		expanded[label] = extensions[k]
+	}
+
+	return expanded
+}
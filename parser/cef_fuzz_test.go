@@ -0,0 +1,56 @@
+//go:build go1.18
+// +build go1.18
+
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func FuzzParseCef(f *testing.F) {
+	for _, message := range []string{cefMessage1, cefMessage2, cefMessage3, cefMessage5, cefMessage6} {
+		f.Add(message)
+	}
+
+	f.Fuzz(func(t *testing.T, message string) {
+		// Any input must either parse or error without panicking
+		if _, err := ParseCef(message); err != nil {
+			return
+		}
+
+		if _, err := (&CefParser{expandKeys: true}).Parse(message, nil); err != nil {
+			t.Errorf("failed to parse CEF message with expanded keys after parsing without: %v", err)
+		}
+	})
+}
+
+func FuzzParseCefExtensionValue(f *testing.F) {
+	for _, value := range []string{"a = b", "x\\y", "line1\nline2", "a|b", "{{COLON}} key=value", "C:\\Temp\\"} {
+		f.Add(value)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		// Surrounding whitespace is not significant in extension values
+		if strings.TrimSpace(value) != value {
+			return
+		}
+
+		escaped := strings.NewReplacer("\\", "\\\\", "=", "\\=", "\n", "\\n", "\r", "\\r").Replace(value)
+		message := "CEF:0|Vendor|Product|1.0|100|Fuzz|5|msg=" + escaped + " src=10.0.0.1"
+
+		cefObj, err := cefStringToObject(message)
+
+		if err != nil {
+			t.Fatalf("failed to parse CEF message %q: %v", message, err)
+		}
+
+		if cefObj.Extensions["msg"] != value {
+			t.Errorf(`cefStringToObject(%q).Extensions["msg"] got %q; expected %q`, message, cefObj.Extensions["msg"], value)
+		}
+
+		if cefObj.Extensions["src"] != "10.0.0.1" {
+			t.Errorf(`cefStringToObject(%q).Extensions["src"] got %q; expected %q`, message, cefObj.Extensions["src"], "10.0.0.1")
+		}
+	})
+}
@@ -1,6 +1,14 @@
 package parser
 
-import "testing"
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dlclark/regexp2"
+	"github.com/jjeffery/kv"
+)
 
 var cefMessage1 = "0|illusive|illusive|3.1.128.1719|illusive:heartbeat|Heartbeat|0|dvc=10.118.182.162 rt=1600239263565 cat=illusive:SYS"
 var cefMessage2 = "CEF:0|Cool Vendor|Cool Product|1.0|FLAKY_EVENT|Something flaky happened.|3|requestClientApplication=Go-http-client/1.1 sourceAddress=127.0.0.1"
@@ -84,7 +92,7 @@ func TestParseCef2(t *testing.T) {
 }
 
 func TestParseCef3(t *testing.T) {
-	cefExpectedKeyValuePair1 := []string{"msg", `theuser@domain.local logged out {User role \\= ROLE_ADMIN; Source address \\= 10.120.10.152}`}
+	cefExpectedKeyValuePair1 := []string{"msg", `theuser@domain.local logged out {User role \= ROLE_ADMIN; Source address \= 10.120.10.152}`}
 	cefExpectedKeyValuePair2 := []string{"duser", "theuser@domain.local"}
 	cefExpectedKeyValuePair3 := []string{"outcome", "SUCCESS"}
 	cefExpectedKeyValues := [][]string{cefExpectedKeyValuePair1, cefExpectedKeyValuePair2, cefExpectedKeyValuePair3}
@@ -115,4 +123,344 @@ func TestParseCef4(t *testing.T) {
 	if _, err := ParseCef(cefMessage4); err == nil {
 		t.Errorf("failed to error on invalid CEF message: %v", err)
 	}
-}
\ No newline at end of file
+}
+
+var cefMessage6 = `CEF:0|Vendor\|Inc|Product|1.0|100|Tokens|5|msg=literal {{COLON}} {{SPACE}} and a|b pipe src_ip=10.0.0.1 ad.user=bob request=https://example.com/?a\=1&b\=2 note=a = b x=first\nsecond path=C:\\Temp\\`
+
+func TestParseCefExtensions(t *testing.T) {
+	cefObj, err := cefStringToObject(cefMessage6)
+
+	if err != nil {
+		t.Fatalf("failed to parse CEF message: %v", err)
+	}
+
+	if cefObj.DeviceVendor != "Vendor|Inc" {
+		t.Errorf("cefStringToObject(message6).DeviceVendor got %s; expected %s", cefObj.DeviceVendor, "Vendor|Inc")
+	}
+
+	cefExpectedKeyValues := [][]string{
+		{"msg", "literal {{COLON}} {{SPACE}} and a|b pipe"},
+		{"src_ip", "10.0.0.1"},
+		{"ad.user", "bob"},
+		{"request", "https://example.com/?a=1&b=2"},
+		{"note", "a = b"},
+		{"x", "first\nsecond"},
+		{"path", `C:\Temp\`},
+	}
+
+	for _, v := range cefExpectedKeyValues {
+		if cefObj.Extensions[v[0]] != v[1] {
+			t.Errorf(`cefStringToObject(message6).Extensions["%s"] got %q; expected %q`, v[0], cefObj.Extensions[v[0]], v[1])
+		}
+	}
+
+	if len(cefObj.Extensions) != len(cefExpectedKeyValues) {
+		t.Errorf("len(cefStringToObject(message6).Extensions) got %v; expected %v", len(cefObj.Extensions), len(cefExpectedKeyValues))
+	}
+
+	if extensions, err := parseCefExtensions("  "); err != nil || len(extensions) != 0 {
+		t.Errorf(`parseCefExtensions("  ") got %v, %v; expected empty map`, extensions, err)
+	}
+
+	if _, err := parseCefExtensions("not an extension"); err == nil {
+		t.Errorf("failed to error on invalid CEF extensions")
+	}
+}
+
+// cefStringToObjectLegacy is the placeholder substitution implementation replaced by parseCefExtensions,
+// kept to benchmark against
+func cefStringToObjectLegacy(cefString string) (map[string]string, error) {
+	arr := strings.Split(cefString, "|")
+
+	if len(arr) < 8 {
+		return nil, fmt.Errorf("invalid CEF format")
+	}
+
+	extensions := strings.Join(arr[7:], "|")
+
+	safeExtensions := strings.ReplaceAll(extensions, ":", "{{COLON}}")
+	safeExtensions = strings.ReplaceAll(safeExtensions, `\\=`, "{{EQUAL_ESCAPE_2}}")
+	safeExtensions = strings.ReplaceAll(safeExtensions, `\=`, "{{EQUAL_ESCAPE_1}}")
+
+	re := regexp2.MustCompile(`\s(?![a-z0-9A-Z]+\=)`, 0)
+	safeExtensions2, err := re.Replace(safeExtensions, "{{SPACE}}", -1, -1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	text, list := kv.Parse([]byte(safeExtensions2))
+
+	if len(text) > 0 {
+		return nil, fmt.Errorf(`invalid key value format at: "%s"`, string(text))
+	}
+
+	replacer := strings.NewReplacer(
+		`{{SPACE}}`, " ",
+		`{{EQUAL_ESCAPE_1}}`, `\=`,
+		`{{EQUAL_ESCAPE_2}}`, `\\=`,
+		`{{COLON}}`, ":",
+	)
+
+	newKeyValueMap := make(map[string]string, 0)
+	for i := 0; i < len(list); i += 2 {
+		newKeyValueMap[replacer.Replace(list[i].(string))] = strings.TrimSpace(replacer.Replace(list[i+1].(string)))
+	}
+
+	return newKeyValueMap, nil
+}
+
+func BenchmarkCefStringToObjectLegacy(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := cefStringToObjectLegacy(cefMessage3); err != nil {
+			b.Fatalf("failed to parse CEF message: %v", err)
+		}
+	}
+}
+
+func BenchmarkCefStringToObject(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := cefStringToObject(cefMessage3); err != nil {
+			b.Fatalf("failed to parse CEF message: %v", err)
+		}
+	}
+}
+
+var cefMessage7 = `<134>Sep 16 12:00:00 fw01 CEF:0|Vendor|Product|1.0|100|Prefixed|5|src=10.0.0.1`
+var cefMessage8 = `threatd[123]: note CEF: marker CEF:1|Vendor|Product|1.0|100|Tagged|5|src=10.0.0.2`
+
+func TestParseCefPrefix(t *testing.T) {
+	cefExpectedPrefixes := [][]string{
+		{cefMessage7, "<134>Sep 16 12:00:00 fw01", "10.0.0.1"},
+		{cefMessage8, "threatd[123]: note CEF: marker", "10.0.0.2"},
+		{"CEF:0|Vendor|Product|1.0|100|Plain|5|src=10.0.0.3", "", "10.0.0.3"},
+	}
+
+	for _, v := range cefExpectedPrefixes {
+		cefObj, err := cefStringToObject(v[0])
+
+		if err != nil {
+			t.Fatalf("failed to parse CEF message: %v", err)
+		}
+
+		if cefObj.Prefix != v[1] {
+			t.Errorf("cefStringToObject(%s).Prefix got %s; expected %s", v[0], cefObj.Prefix, v[1])
+		}
+
+		if cefObj.Extensions["src"] != v[2] {
+			t.Errorf(`cefStringToObject(%s).Extensions["src"] got %s; expected %s`, v[0], cefObj.Extensions["src"], v[2])
+		}
+	}
+
+	if jsonString, _ := ParseCef(cefMessage2); strings.Contains(string(jsonString), "Prefix") {
+		t.Errorf("ParseCef(message2) got %s; expected no Prefix field", jsonString)
+	}
+
+	for _, message := range []string{"host CEF:x|Vendor|Product|1.0|100|Bad|5|src=10.0.0.1", "host CEF:0|Vendor|Product"} {
+		if _, err := ParseCef(message); err == nil {
+			t.Errorf("failed to error on invalid CEF message: %s", message)
+		}
+	}
+}
+
+var cefMessage5 = `CEF:0|Palo Alto Networks|PAN-OS|9.1|end|TRAFFIC|1|rt=1600239263565 src=10.0.0.1 dst=8.8.8.8 spt=51234 dpt=53 cs1=allow-dns cs1Label=Rule cn1=42 cn1Label=SessionID cs2=trust cs3=untrust cs3Label=DestinationZone flexString1=abc`
+
+func TestParseCefExpandKeys(t *testing.T) {
+	cefObj, err := cefStringToObject(cefMessage5)
+
+	if err != nil {
+		t.Fatalf("failed to parse CEF message: %v", err)
+	}
+
+	extensions := expandCefExtensions(convertCefExtensions(cefObj.Extensions))
+
+	cefExpectedKeyValues := [][]interface{}{
+		{"deviceReceiptTime", "2020-09-16T06:54:23.565Z"},
+		{"sourceAddress", "10.0.0.1"},
+		{"destinationAddress", "8.8.8.8"},
+		{"sourcePort", int64(51234)},
+		{"destinationPort", int64(53)},
+		{"Rule", "allow-dns"},
+		{"SessionID", int64(42)},
+		{"DestinationZone", "untrust"},
+		{"deviceCustomString2", "trust"},
+		{"flexString1", "abc"},
+	}
+
+	for _, v := range cefExpectedKeyValues {
+		if extensions[v[0].(string)] != v[1] {
+			t.Errorf(`expandCefExtensions(message5)["%s"] got %v; expected %v`, v[0], extensions[v[0].(string)], v[1])
+		}
+	}
+
+	for _, k := range []string{"cs1", "cs1Label", "deviceCustomString1", "deviceCustomString1Label", "src", "rt"} {
+		if _, ok := extensions[k]; ok {
+			t.Errorf(`expandCefExtensions(message5)["%s"] should not exist`, k)
+		}
+	}
+
+	if len(extensions) != len(cefExpectedKeyValues) {
+		t.Errorf("len(expandCefExtensions(message5)) got %v; expected %v", len(extensions), len(cefExpectedKeyValues))
+	}
+}
+
+func TestParseCefExpandKeysCollision(t *testing.T) {
+	extensions := expandCefExtensions(map[string]interface{}{
+		"src":      "10.0.0.1",
+		"cs1":      "10.0.0.2",
+		"cs1Label": "sourceAddress",
+		"cs2":      "value",
+		"cs2Label": "",
+	})
+
+	cefExpectedKeyValues := [][]string{
+		{"sourceAddress", "10.0.0.1"},
+		{"deviceCustomString1", "10.0.0.2"},
+		{"deviceCustomString1Label", "sourceAddress"},
+		{"deviceCustomString2", "value"},
+	}
+
+	for _, v := range cefExpectedKeyValues {
+		if extensions[v[0]] != v[1] {
+			t.Errorf(`expandCefExtensions()["%s"] got %v; expected %s`, v[0], extensions[v[0]], v[1])
+		}
+	}
+
+	p, err := New("cef", &Config{CefExpandKeys: true})
+
+	if err != nil {
+		t.Fatalf("failed to create cef parser: %v", err)
+	}
+
+	jsonString, err := p.Parse(cefMessage1, nil)
+
+	if err != nil {
+		t.Fatalf("failed to parse CEF message: %v", err)
+	}
+
+	if !strings.Contains(string(jsonString), `"deviceAddress":"10.118.182.162"`) {
+		t.Errorf("p.Parse(message1) got %s; expected deviceAddress field", jsonString)
+	}
+}
+
+func TestCefFullKey(t *testing.T) {
+	tests := map[string]string{
+		"src":       "sourceAddress",
+		"reason":    "reason",
+		"cs6":       "deviceCustomString6",
+		"cs6Label":  "deviceCustomString6Label",
+		"cn3":       "deviceCustomNumber3",
+		"cfp4":      "deviceCustomFloatingPoint4",
+		"c6a4Label": "deviceCustomIPv6Address4Label",
+		"cs7":       "cs7",
+		"cn5":       "cn5",
+		"cfp6":      "cfp6",
+		"c6a5":      "c6a5",
+		"c6a5Label": "c6a5Label",
+	}
+
+	for key, expected := range tests {
+		if fullKey := cefFullKey(key); fullKey != expected {
+			t.Errorf("cefFullKey(%s) got %s; expected %s", key, fullKey, expected)
+		}
+	}
+}
+
+func TestParseCefTypedValues(t *testing.T) {
+	jsonString, err := ParseCef("CEF:0|Vendor|Product|1.0|100|Connection|7|rt=1600239263565 dpt=53 cfp1=1.5 src=10.0.0.1 start=Sep 16 2020 12:00:00 dtz=UTC cat=net")
+
+	if err != nil {
+		t.Fatalf("failed to parse CEF message: %v", err)
+	}
+
+	cefExpectedValues := []string{
+		`"Severity":7`,
+		`"rt":"2020-09-16T06:54:23.565Z"`,
+		`"dpt":53`,
+		`"cfp1":1.5`,
+		`"src":"10.0.0.1"`,
+		`"start":"2020-09-16T12:00:00Z"`,
+		`"cat":"net"`,
+	}
+
+	for _, v := range cefExpectedValues {
+		if !strings.Contains(string(jsonString), v) {
+			t.Errorf("ParseCef() got %s; expected %s", jsonString, v)
+		}
+	}
+
+	// Values that do not match their data type are kept as strings
+	if v := convertCefValue("unknown", cefInteger, nil); v != "unknown" {
+		t.Errorf(`convertCefValue("unknown") got %v; expected %s`, v, "unknown")
+	}
+
+	// Device time zones are loaded once
+	if l, ok := cefLocation("America/New_York"); !ok || l.String() != "America/New_York" {
+		t.Errorf(`cefLocation("America/New_York") got %v; expected America/New_York`, l)
+	}
+
+	if _, ok := cefLocations.Load("America/New_York"); !ok {
+		t.Errorf("failed to cache device time zone")
+	}
+
+	if _, ok := cefLocation("Not/A_Zone"); ok {
+		t.Errorf("failed to reject unknown device time zone")
+	}
+}
+
+func TestParseCefTimeZones(t *testing.T) {
+	losAngeles, _ := cefLocation("America/Los_Angeles")
+
+	tests := []struct {
+		value    string
+		location *time.Location
+		expected string
+	}{
+		{"Sep 16 2020 12:00:00", time.UTC, "2020-09-16T12:00:00Z"},
+		{"Sep 16 2020 12:00:00 UTC", losAngeles, "2020-09-16T12:00:00Z"},
+		{"Sep 16 2020 12:00:00 PDT", losAngeles, "2020-09-16T12:00:00-07:00"},
+		{"Sep 16 2020 12:00:00 PDT", time.UTC, ""},
+		{"Sep 16 2020 12:00:00 EST", losAngeles, ""},
+		{"Sep 16 2020 12:00:00.000 XYZ", time.UTC, ""},
+	}
+
+	for _, test := range tests {
+		result, ok := parseCefTime(test.value, test.location)
+
+		if test.expected == "" {
+			if ok {
+				t.Errorf("parseCefTime(%q) got %s; expected unknown zone to be rejected", test.value, result.Format(time.RFC3339))
+			}
+			continue
+		}
+
+		if !ok || result.Format(time.RFC3339) != test.expected {
+			t.Errorf("parseCefTime(%q) got %s, %v; expected %s", test.value, result.Format(time.RFC3339), ok, test.expected)
+		}
+	}
+
+	// Time stamps with an unknown zone are kept as strings
+	if v := convertCefValue("Sep 16 2020 12:00:00 PDT", cefTimeStamp, time.UTC); v != "Sep 16 2020 12:00:00 PDT" {
+		t.Errorf("convertCefValue() got %v; expected the original string", v)
+	}
+}
+
+func TestParseCefStringValues(t *testing.T) {
+	p, err := New("cef", &Config{CefStringValues: true})
+
+	if err != nil {
+		t.Fatalf("failed to create cef parser: %v", err)
+	}
+
+	jsonString, err := p.Parse(cefMessage1, nil)
+
+	if err != nil {
+		t.Fatalf("failed to parse CEF message: %v", err)
+	}
+
+	for _, v := range []string{`"Severity":"0"`, `"rt":"1600239263565"`} {
+		if !strings.Contains(string(jsonString), v) {
+			t.Errorf("p.Parse(message1) got %s; expected %s", jsonString, v)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package parser
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CEF dictionary data types
+const (
+	cefInteger   = "Integer"
+	cefLong      = "Long"
+	cefDouble    = "Double"
+	cefIPAddress = "IP Address"
+	cefTimeStamp = "Time Stamp"
+)
+
+// cefFieldTypes maps the CEF extension keys (short and full names) to their dictionary data types.
+// Keys that are not listed are passed through as strings.
+var cefFieldTypes = map[string]string{
+	"cnt":                          cefInteger,
+	"baseEventCount":               cefInteger,
+	"dpid":                         cefInteger,
+	"destinationProcessId":         cefInteger,
+	"dpt":                          cefInteger,
+	"destinationPort":              cefInteger,
+	"destinationTranslatedPort":    cefInteger,
+	"deviceDirection":              cefInteger,
+	"dvcpid":                       cefInteger,
+	"deviceProcessId":              cefInteger,
+	"fsize":                        cefInteger,
+	"fileSize":                     cefInteger,
+	"in":                           cefInteger,
+	"bytesIn":                      cefInteger,
+	"oldFileSize":                  cefInteger,
+	"out":                          cefInteger,
+	"bytesOut":                     cefInteger,
+	"spid":                         cefInteger,
+	"sourceProcessId":              cefInteger,
+	"spt":                          cefInteger,
+	"sourcePort":                   cefInteger,
+	"sourceTranslatedPort":         cefInteger,
+	"type":                         cefInteger,
+	"cn1":                          cefLong,
+	"cn2":                          cefLong,
+	"cn3":                          cefLong,
+	"deviceCustomNumber1":          cefLong,
+	"deviceCustomNumber2":          cefLong,
+	"deviceCustomNumber3":          cefLong,
+	"flexNumber1":                  cefLong,
+	"flexNumber2":                  cefLong,
+	"cfp1":                         cefDouble,
+	"cfp2":                         cefDouble,
+	"cfp3":                         cefDouble,
+	"cfp4":                         cefDouble,
+	"deviceCustomFloatingPoint1":   cefDouble,
+	"deviceCustomFloatingPoint2":   cefDouble,
+	"deviceCustomFloatingPoint3":   cefDouble,
+	"deviceCustomFloatingPoint4":   cefDouble,
+	"dlat":                         cefDouble,
+	"dlong":                        cefDouble,
+	"slat":                         cefDouble,
+	"slong":                        cefDouble,
+	"agt":                          cefIPAddress,
+	"agentAddress":                 cefIPAddress,
+	"c6a1":                         cefIPAddress,
+	"c6a2":                         cefIPAddress,
+	"c6a3":                         cefIPAddress,
+	"c6a4":                         cefIPAddress,
+	"deviceCustomIPv6Address1":     cefIPAddress,
+	"deviceCustomIPv6Address2":     cefIPAddress,
+	"deviceCustomIPv6Address3":     cefIPAddress,
+	"deviceCustomIPv6Address4":     cefIPAddress,
+	"dst":                          cefIPAddress,
+	"destinationAddress":           cefIPAddress,
+	"destinationTranslatedAddress": cefIPAddress,
+	"deviceTranslatedAddress":      cefIPAddress,
+	"dvc":                          cefIPAddress,
+	"deviceAddress":                cefIPAddress,
+	"src":                          cefIPAddress,
+	"sourceAddress":                cefIPAddress,
+	"sourceTranslatedAddress":      cefIPAddress,
+	"art":                          cefTimeStamp,
+	"agentReceiptTime":             cefTimeStamp,
+	"deviceCustomDate1":            cefTimeStamp,
+	"deviceCustomDate2":            cefTimeStamp,
+	"end":                          cefTimeStamp,
+	"endTime":                      cefTimeStamp,
+	"fileCreateTime":               cefTimeStamp,
+	"fileModificationTime":         cefTimeStamp,
+	"flexDate1":                    cefTimeStamp,
+	"oldFileCreateTime":            cefTimeStamp,
+	"oldFileModificationTime":      cefTimeStamp,
+	"rt":                           cefTimeStamp,
+	"deviceReceiptTime":            cefTimeStamp,
+	"start":                        cefTimeStamp,
+	"startTime":                    cefTimeStamp,
+}
+
+// cefTimeLayouts are the CEF Time Stamp formats other than milliseconds since epoch
+var cefTimeLayouts = []string{
+	"Jan 2 2006 15:04:05.000 MST",
+	"Jan 2 2006 15:04:05.000",
+	"Jan 2 2006 15:04:05 MST",
+	"Jan 2 2006 15:04:05",
+	"Jan 2 15:04:05.000 MST",
+	"Jan 2 15:04:05.000",
+	"Jan 2 15:04:05 MST",
+	"Jan 2 15:04:05",
+}
+
+// convertCefExtensions converts the values of known CEF dictionary fields to their data types.
+// Time stamps are converted to RFC 3339 in the device time zone (dtz) when supplied, otherwise
+// UTC. Values that do not match their data type are kept as strings.
+func convertCefExtensions(extensions map[string]string) map[string]interface{} {
+	converted := make(map[string]interface{}, len(extensions))
+
+	// Device time zone for time stamps without a zone
+	location := time.UTC
+	for _, k := range []string{"dtz", "deviceTimeZone"} {
+		if tz, ok := extensions[k]; ok {
+			if l, ok := cefLocation(tz); ok {
+				location = l
+			}
+		}
+	}
+
+	for k, v := range extensions {
+		converted[k] = convertCefValue(v, cefFieldTypes[k], location)
+	}
+
+	return converted
+}
+
+// convertCefValue converts the value to the supplied CEF data type
+func convertCefValue(value, dataType string, location *time.Location) interface{} {
+	switch dataType {
+	case cefInteger, cefLong:
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+	case cefDouble:
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	case cefIPAddress:
+		if ip := net.ParseIP(value); ip != nil {
+			return ip.String()
+		}
+	case cefTimeStamp:
+		if t, ok := parseCefTime(value, location); ok {
+			return t.Format(time.RFC3339Nano)
+		}
+	}
+
+	return value
+}
+
+// convertCefSeverity converts the numeric (0-10) Severity header to an integer. Named severities
+// (Low, Medium, High, Very-High) are kept as strings.
+func convertCefSeverity(severity string) interface{} {
+	if i, err := strconv.Atoi(severity); err == nil {
+		return i
+	}
+
+	return severity
+}
+
+// cefLocations caches the device time zones loaded by cefLocation
+var cefLocations sync.Map
+
+// cefLocation returns the location of the time zone name. Loaded locations are cached, as loading
+// reads the time zone database. Unknown names are not cached, so the cache is bounded by the
+// database.
+func cefLocation(name string) (*time.Location, bool) {
+	if l, ok := cefLocations.Load(name); ok {
+		return l.(*time.Location), true
+	}
+
+	l, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, false
+	}
+
+	cefLocations.Store(name, l)
+	return l, true
+}
+
+// knownCefZone returns whether the zone of the parsed time stamp is the location, UTC or a zone with
+// a known offset
+func knownCefZone(t time.Time, location *time.Location) bool {
+	name, offset := t.Zone()
+	return offset != 0 || t.Location() == location || name == "UTC" || name == "GMT"
+}
+
+// parseCefTime parses a CEF Time Stamp in milliseconds since epoch or one of the CEF date formats
+func parseCefTime(value string, location *time.Location) (time.Time, bool) {
+	if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(0, millis*int64(time.Millisecond)).UTC(), true
+	}
+
+	for _, layout := range cefTimeLayouts {
+		t, err := time.ParseInLocation(layout, value, location)
+		if err != nil {
+			continue
+		}
+
+		// Go gives a zone abbreviation unknown to the location a zero offset, so keep the string
+		if !knownCefZone(t, location) {
+			return time.Time{}, false
+		}
+
+		// Formats without a year are assumed to be from the current year
+		if t.Year() == 0 {
+			t = t.AddDate(time.Now().In(location).Year(), 0, 0)
+		}
+
+		return t, true
+	}
+
+	return time.Time{}, false
+}
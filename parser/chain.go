@@ -0,0 +1,78 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Chain tries each of its parsers in order and returns the result of the first one that
+// successfully parses the message.
+type Chain struct {
+	parsers []Parser
+}
+
+// NewChain constructs a fallback chain from the supplied parser names
+func NewChain(names []string, config *Config) (*Chain, error) {
+	if len(names) == 0 {
+		return nil, errors.New("parser chain requires at least one parser")
+	}
+
+	chain := &Chain{}
+	for _, name := range names {
+		p, err := New(name, config)
+		if err != nil {
+			return nil, err
+		}
+		chain.parsers = append(chain.parsers, p)
+	}
+
+	return chain, nil
+}
+
+// Name returns the comma separated names of the parsers in the chain
+func (c *Chain) Name() string {
+	names := make([]string, 0, len(c.parsers))
+	for _, p := range c.parsers {
+		names = append(names, p.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+// Len returns the number of parsers in the chain
+func (c *Chain) Len() int {
+	return len(c.parsers)
+}
+
+// Parse converts the message with the first parser in the chain that succeeds
+func (c *Chain) Parse(message string, logParts map[string]interface{}) ([]byte, error) {
+	jsonString, _, err := c.ParseWithName(message, logParts)
+	return jsonString, err
+}
+
+// ParseWithName converts the message with the first parser in the chain that succeeds and
+// returns the name of that parser alongside the result.
+func (c *Chain) ParseWithName(message string, logParts map[string]interface{}) ([]byte, string, error) {
+	errs := make([]string, 0, len(c.parsers))
+	var lastErr error
+
+	for _, p := range c.parsers {
+		jsonString, err := p.Parse(message, logParts)
+		if err == nil && jsonString != nil {
+			return jsonString, p.Name(), nil
+		}
+
+		if err == nil {
+			err = errors.New("parse result resulted in nil object")
+		}
+		lastErr = err
+		errs = append(errs, fmt.Sprintf("%s: %v", p.Name(), err))
+	}
+
+	// Keep the original error for single parser chains
+	if len(errs) == 1 {
+		return nil, "", lastErr
+	}
+
+	return nil, "", fmt.Errorf("no parser succeeded (%s)", strings.Join(errs, "; "))
+}
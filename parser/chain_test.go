@@ -0,0 +1,91 @@
+package parser
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	chain, err := NewChain([]string{"cef", "json", "kv"}, nil)
+
+	if err != nil {
+		t.Fatalf("failed to create parser chain: %v", err)
+	}
+
+	if chain.Name() != "cef,json,kv" {
+		t.Errorf("chain.Name() got %s; expected %s", chain.Name(), "cef,json,kv")
+	}
+
+	chainExpectedParsers := [][]string{
+		{cefMessage2, "cef"},
+		{`{"key":"value"}`, "json"},
+		{"dvc=10.118.182.162 rt=1600239263565", "kv"},
+	}
+
+	for _, v := range chainExpectedParsers {
+		result, name, err := chain.ParseWithName(v[0], nil)
+
+		if err != nil {
+			t.Errorf("failed to parse message %s: %v", v[0], err)
+			continue
+		}
+
+		if name != v[1] {
+			t.Errorf("chain.ParseWithName(%s) parser got %s; expected %s", v[0], name, v[1])
+		}
+
+		if !json.Valid(result) {
+			t.Errorf("chain.ParseWithName(%s) returned invalid JSON: %s", v[0], result)
+		}
+	}
+
+	if _, _, err := chain.ParseWithName("not a structured message at all", nil); err == nil {
+		t.Errorf("failed to error when no parser succeeds")
+	}
+}
+
+func TestChainRawFallback(t *testing.T) {
+	chain, err := NewChain([]string{"json", "raw"}, nil)
+
+	if err != nil {
+		t.Fatalf("failed to create parser chain: %v", err)
+	}
+
+	logParts := map[string]interface{}{"content": "plain text", "hostname": "host1"}
+
+	result, name, err := chain.ParseWithName("plain text", logParts)
+
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+
+	if name != "raw" {
+		t.Errorf("chain.ParseWithName() parser got %s; expected %s", name, "raw")
+	}
+
+	resultMap := make(map[string]interface{})
+	if err := json.Unmarshal(result, &resultMap); err != nil {
+		t.Fatalf("failed to unmarshal result: %v", err)
+	}
+
+	if resultMap["hostname"] != "host1" {
+		t.Errorf(`resultMap["hostname"] got %v; expected %s`, resultMap["hostname"], "host1")
+	}
+
+	// JSON values other than objects fall back to raw
+	for _, message := range []string{"12345", `"text"`, "[1,2]"} {
+		if _, name, err := chain.ParseWithName(message, logParts); err != nil || name != "raw" {
+			t.Errorf("chain.ParseWithName(%s) parser got %s, %v; expected %s", message, name, err, "raw")
+		}
+	}
+}
+
+func TestNewChain(t *testing.T) {
+	if _, err := NewChain([]string{}, nil); err == nil {
+		t.Errorf("failed to error on empty parser chain")
+	}
+
+	if _, err := NewChain([]string{"json", "unknown"}, nil); err == nil {
+		t.Errorf("failed to error on unknown parser in chain")
+	}
+}
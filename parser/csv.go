@@ -0,0 +1,166 @@
+package parser
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+func init() {
+	Register("csv", func(config *Config) (Parser, error) {
+		var schemas *CsvSchemas
+
+		if config.CsvSchemaFile != "" {
+			s, err := LoadCsvSchemas(config.CsvSchemaFile)
+			if err != nil {
+				return nil, err
+			}
+			schemas = s
+		}
+
+		return NewCsvParser(config.CsvDelimiter, config.CsvLazyQuotes, config.CsvColumns, schemas)
+	})
+}
+
+// CsvSchemas holds column name lists selected by the value of a discriminator column, such as the
+// type column (index 3) of Palo Alto Networks logs
+type CsvSchemas struct {
+	Discriminator int                 `json:"discriminator"`
+	Schemas       map[string][]string `json:"schemas"`
+}
+
+// CsvParser parses a delimited message into an object keyed by column name
+type CsvParser struct {
+	delimiter  rune
+	lazyQuotes bool
+	columns    []string
+	schemas    *CsvSchemas
+}
+
+// NewCsvParser creates a parser for delimited messages. Columns are named from the schema selected by
+// the discriminator column when schemas are supplied, otherwise (or when no schema matches) from the
+// column list. Columns with an empty name are dropped and columns beyond the names are named
+// column_N (1-based). An empty delimiter defaults to a comma and \t is accepted for tab.
+func NewCsvParser(delimiter string, lazyQuotes bool, columns []string, schemas *CsvSchemas) (*CsvParser, error) {
+	if len(columns) == 0 && (schemas == nil || len(schemas.Schemas) == 0) {
+		return nil, errors.New("csv parser requires columns or a schema file")
+	}
+
+	// Validate delimiter
+	switch delimiter {
+	case "":
+		delimiter = ","
+	case `\t`:
+		delimiter = "\t"
+	}
+
+	d, size := utf8.DecodeRuneInString(delimiter)
+	if size != len(delimiter) || d == '"' || d == '\r' || d == '\n' || d == utf8.RuneError {
+		return nil, fmt.Errorf("invalid csv delimiter: %q", delimiter)
+	}
+
+	if schemas != nil && schemas.Discriminator < 0 {
+		return nil, fmt.Errorf("invalid csv schema discriminator column: %d", schemas.Discriminator)
+	}
+
+	return &CsvParser{delimiter: d, lazyQuotes: lazyQuotes, columns: columns, schemas: schemas}, nil
+}
+
+func (p *CsvParser) Name() string {
+	return "csv"
+}
+
+func (p *CsvParser) Parse(message string, _ map[string]interface{}) ([]byte, error) {
+	result, err := p.parseEvent(message)
+
+	// Handle errors
+	if err != nil {
+		return nil, err
+	}
+
+	// Marshal JSON string
+	return json.Marshal(result)
+}
+
+// parseEvent reads a single record from the message and names its columns
+func (p *CsvParser) parseEvent(event string) (map[string]string, error) {
+	reader := csv.NewReader(strings.NewReader(strings.TrimRight(event, "\r\n")))
+	reader.Comma = p.delimiter
+	reader.LazyQuotes = p.lazyQuotes
+	reader.FieldsPerRecord = -1
+
+	record, err := reader.Read()
+
+	// Handle errors
+	if err == io.EOF {
+		return nil, errors.New("empty csv message")
+	} else if err != nil {
+		return nil, fmt.Errorf("invalid csv format: %v", err)
+	}
+
+	// Only a single record per message
+	if _, err := reader.Read(); err != io.EOF {
+		return nil, errors.New("invalid csv format: multiple records")
+	}
+
+	columns, err := p.schema(record)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Name columns
+	result := make(map[string]string, len(record))
+	for i, v := range record {
+		if i >= len(columns) {
+			result["column_"+strconv.Itoa(i+1)] = v
+		} else if columns[i] != "" {
+			result[columns[i]] = v
+		}
+	}
+
+	return result, nil
+}
+
+// schema returns the column names for the record
+func (p *CsvParser) schema(record []string) ([]string, error) {
+	if p.schemas != nil && p.schemas.Discriminator < len(record) {
+		if columns, ok := p.schemas.Schemas[record[p.schemas.Discriminator]]; ok {
+			return columns, nil
+		}
+	}
+
+	if len(p.columns) == 0 {
+		return nil, errors.New("unable to parse: no csv schema matched")
+	}
+
+	return p.columns, nil
+}
+
+// LoadCsvSchemas reads a JSON schema file with the discriminator column index (0-based) and the column
+// names for each discriminator value:
+//
+//	{"discriminator": 3, "schemas": {"TRAFFIC": ["future_use", "receive_time", ...], "THREAT": [...]}}
+func LoadCsvSchemas(path string) (*CsvSchemas, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read csv schema file: %v", err)
+	}
+
+	schemas := &CsvSchemas{}
+	if err := json.Unmarshal(data, schemas); err != nil {
+		return nil, fmt.Errorf("invalid csv schema file %s: %v", path, err)
+	}
+
+	if len(schemas.Schemas) == 0 {
+		return nil, fmt.Errorf("invalid csv schema file %s: no schemas", path)
+	}
+
+	return schemas, nil
+}
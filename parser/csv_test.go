@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var csvMessage1 = `1,2020/09/16 12:00:00,001801000000,TRAFFIC,end,2305,2020/09/16 12:00:00,10.0.0.1,8.8.8.8`
+var csvMessage2 = `1,2020/09/16 12:00:00,001801000000,THREAT,url,2305,2020/09/16 12:00:00,10.0.0.1,"http://example.com/a,b"`
+var csvMessage3 = "host01\t\"quoted\tvalue\"\t200"
+
+func TestCsvParser(t *testing.T) {
+	p, err := NewCsvParser(`\t`, false, []string{"host", "", "status"}, nil)
+
+	if err != nil {
+		t.Fatalf("failed to create csv parser: %v", err)
+	}
+
+	resultMap, err := p.parseEvent(csvMessage3)
+
+	if err != nil {
+		t.Fatalf("failed to parse CSV message: %v", err)
+	}
+
+	if len(resultMap) != 2 || resultMap["host"] != "host01" || resultMap["status"] != "200" {
+		t.Errorf("p.parseEvent(message3) got %v; expected host and status columns", resultMap)
+	}
+
+	resultMap, err = p.parseEvent("a\tb\tc\td")
+
+	if err != nil {
+		t.Fatalf("failed to parse CSV message: %v", err)
+	}
+
+	if resultMap["column_4"] != "d" {
+		t.Errorf(`p.parseEvent()["column_4"] got %s; expected %s`, resultMap["column_4"], "d")
+	}
+
+	if _, err := p.parseEvent("a\t\"b\tc"); err == nil {
+		t.Errorf("failed to error on invalid CSV message")
+	}
+
+	if _, err := NewCsvParser("", false, nil, nil); err == nil {
+		t.Errorf("failed to error on csv parser without columns")
+	}
+
+	if _, err := NewCsvParser(`"`, false, []string{"a"}, nil); err == nil {
+		t.Errorf("failed to error on invalid csv delimiter")
+	}
+}
+
+func TestCsvParserSchemas(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csv")
+
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	schemaFile := filepath.Join(dir, "pan.json")
+	schema := `{"discriminator": 3, "schemas": {
+		"TRAFFIC": ["", "receive_time", "serial", "type", "subtype", "", "generated_time", "src", "dst"],
+		"THREAT": ["", "receive_time", "serial", "type", "subtype", "", "generated_time", "src", "url"]
+	}}`
+
+	if err := ioutil.WriteFile(schemaFile, []byte(schema), 0644); err != nil {
+		t.Fatalf("failed to write schema file: %v", err)
+	}
+
+	p, err := New("csv", &Config{CsvSchemaFile: schemaFile})
+
+	if err != nil {
+		t.Fatalf("failed to create csv parser: %v", err)
+	}
+
+	csvExpectedValues := [][]string{
+		{csvMessage1, `{"dst":"8.8.8.8","generated_time":"2020/09/16 12:00:00","receive_time":"2020/09/16 12:00:00","serial":"001801000000","src":"10.0.0.1","subtype":"end","type":"TRAFFIC"}`},
+		{csvMessage2, `{"generated_time":"2020/09/16 12:00:00","receive_time":"2020/09/16 12:00:00","serial":"001801000000","src":"10.0.0.1","subtype":"url","type":"THREAT","url":"http://example.com/a,b"}`},
+	}
+
+	for _, v := range csvExpectedValues {
+		result, err := p.Parse(v[0], nil)
+
+		if err != nil {
+			t.Fatalf("failed to parse CSV message: %v", err)
+		}
+
+		if string(result) != v[1] {
+			t.Errorf("p.Parse(%s) got %s; expected %s", v[0], result, v[1])
+		}
+	}
+
+	if _, err := p.Parse("1,2,3,SYSTEM,general", nil); err == nil {
+		t.Errorf("failed to error on CSV message without a matching schema")
+	}
+
+	if _, err := LoadCsvSchemas(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("failed to error on missing schema file")
+	}
+}
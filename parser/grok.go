@@ -1,12 +1,53 @@
 package parser
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/vjeantet/grok"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
-func parseEventWithGrokPatterns(event string, grokPatterns []string) (map[string]string, error) {
+func init() {
+	Register("grok", func(config *Config) (Parser, error) {
+		definitions, err := LoadGrokPatternDefinitions(config.GrokPatternsDir, config.GrokPatternFiles)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewGrokParser(config.GrokPatterns, definitions, config.GrokFieldTypes)
+	})
+}
+
+// grokTypeHint matches the %{SYNTAX:SEMANTIC:TYPE} form of a grok pattern reference
+var grokTypeHint = regexp.MustCompile(`%{(\w+)(?::(\w+)(?::(\w+))?)?}`)
+
+// grokFieldTypes are the supported grok capture type conversions
+var grokFieldTypes = []string{"string", "int", "float", "bool"}
+
+// GrokParser parses messages with a list of grok patterns that are compiled once when the
+// parser is created. It is safe for concurrent use.
+type GrokParser struct {
+	grok       *grok.Grok
+	patterns   []string
+	fieldTypes []map[string]string
+}
+
+// NewGrokParser compiles the supplied grok patterns and returns a parser that tries them in order.
+// Custom pattern definitions (name to regex) are added to the built-in patterns and can be
+// referenced by name from the grok patterns. Captures are converted to the type hinted in the
+// pattern (%{NUMBER:bytes:int}) or, overriding the hint, to the type in the field type map.
+func NewGrokParser(grokPatterns []string, definitions map[string]string, fieldTypes map[string]string) (*GrokParser, error) {
+	if len(grokPatterns) == 0 {
+		return nil, errors.New("grok parser requires at least one pattern")
+	}
+
 	// Setup grok
 	g, err := grok.NewWithConfig(&grok.Config{NamedCapturesOnly: true})
 
@@ -15,27 +56,85 @@ func parseEventWithGrokPatterns(event string, grokPatterns []string) (map[string
 		return nil, fmt.Errorf("unable to setup grok parser: %v", err)
 	}
 
-	// Setup values map
-	var values map[string]string
+	// Add custom pattern definitions
+	if len(definitions) > 0 {
+		if err := g.AddPatternsFromMap(definitions); err != nil {
+			return nil, fmt.Errorf("invalid grok pattern definitions: %v", err)
+		}
+	}
 
-	// Setup grok string (this will loop through all the patterns until one works or all fail)
+	// Validate field type map
+	for field, fieldType := range fieldTypes {
+		if !contains(grokFieldTypes, fieldType) {
+			return nil, fmt.Errorf("invalid grok field type %s for field %s", fieldType, field)
+		}
+	}
+
+	p := &GrokParser{grok: g, patterns: grokPatterns}
+
+	// Compile every pattern up front (grok caches compiled patterns) so invalid ones fail fast
 	for _, v := range grokPatterns {
-		values, err = g.Parse(v, event)
-		if err == nil {
-			break
+		if _, err := g.Match(v, ""); err != nil {
+			return nil, fmt.Errorf("invalid grok pattern %q: %v", v, err)
+		}
+
+		// Collect type hints from the pattern and the definitions it references
+		types, err := grokPatternTypes(v, definitions, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for field, fieldType := range fieldTypes {
+			types[field] = fieldType
 		}
+
+		p.fieldTypes = append(p.fieldTypes, types)
 	}
 
-	// If none of the patterns worked, print error and skip to next
-	if err != nil {
-		return nil, fmt.Errorf("unable to parse: %v", err)
+	return p, nil
+}
+
+// grokPatternTypes returns the capture type hints in the pattern, following references into the
+// custom definitions. Hints in the pattern take precedence over hints in referenced definitions.
+func grokPatternTypes(pattern string, definitions map[string]string, depth int) (map[string]string, error) {
+	types := make(map[string]string)
+
+	// Guard against definitions that reference each other
+	if depth > 32 {
+		return types, nil
+	}
+
+	for _, match := range grokTypeHint.FindAllStringSubmatch(pattern, -1) {
+		if match[2] != "" && match[3] != "" {
+			if !contains(grokFieldTypes, match[3]) {
+				return nil, fmt.Errorf("invalid grok type hint %s in %s", match[3], match[0])
+			}
+			types[match[2]] = match[3]
+		}
+
+		if definition, ok := definitions[match[1]]; ok {
+			nested, err := grokPatternTypes(definition, definitions, depth+1)
+			if err != nil {
+				return nil, err
+			}
+
+			for field, fieldType := range nested {
+				if _, ok := types[field]; !ok {
+					types[field] = fieldType
+				}
+			}
+		}
 	}
 
-	return values, nil
+	return types, nil
 }
 
-func ParseGrok(event string, grokPatterns []string) ([]byte, error) {
-	values, err := parseEventWithGrokPatterns(event, grokPatterns)
+func (p *GrokParser) Name() string {
+	return "grok"
+}
+
+func (p *GrokParser) Parse(message string, _ map[string]interface{}) ([]byte, error) {
+	values, err := p.parseTypedEvent(message)
 
 	if err != nil {
 		return nil, err
@@ -44,3 +143,162 @@ func ParseGrok(event string, grokPatterns []string) ([]byte, error) {
 	// Marshal map to json
 	return json.Marshal(values)
 }
+
+// parseEvent loops through all the patterns until one matches or all fail
+func (p *GrokParser) parseEvent(event string) (map[string]string, error) {
+	values, _, err := p.match(event)
+	return values, err
+}
+
+// parseTypedEvent parses the event and converts the captures to their hinted types. Values that
+// cannot be converted are kept as strings.
+func (p *GrokParser) parseTypedEvent(event string) (map[string]interface{}, error) {
+	values, index, err := p.match(event)
+
+	if err != nil {
+		return nil, err
+	}
+
+	typedValues := make(map[string]interface{}, len(values))
+	for field, value := range values {
+		typedValues[field] = convertGrokValue(value, p.fieldTypes[index][field])
+	}
+
+	return typedValues, nil
+}
+
+// match returns the captures and index of the first pattern that matches the event. A pattern that
+// matches without capturing anything is still a match. Patterns that fail to parse are skipped.
+func (p *GrokParser) match(event string) (map[string]string, int, error) {
+	var parseErr error
+
+	for i, v := range p.patterns {
+		values, err := p.grok.Parse(v, event)
+		if err != nil {
+			parseErr = err
+			continue
+		}
+
+		if len(values) > 0 {
+			return values, i, nil
+		}
+
+		// Grok returns an empty map both when the pattern does not match and when it has no captures
+		if matched, err := p.grok.Match(v, event); err == nil && matched {
+			return values, i, nil
+		}
+	}
+
+	if parseErr != nil {
+		return nil, -1, fmt.Errorf("unable to parse: %v", parseErr)
+	}
+
+	return nil, -1, errors.New("unable to parse: no grok pattern matched")
+}
+
+// convertGrokValue converts the captured value to the supplied type
+func convertGrokValue(value, fieldType string) interface{} {
+	switch fieldType {
+	case "int":
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+	case "float":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	case "bool":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+
+	return value
+}
+
+// LoadGrokPatternDefinitions reads grok pattern definition files in the `NAME regex` format from
+// every file in the supplied directory and from the supplied files. Blank lines and lines starting
+// with # are ignored. Later definitions override earlier ones.
+func LoadGrokPatternDefinitions(dir string, files []string) (map[string]string, error) {
+	paths := make([]string, 0)
+
+	// Get files in directory
+	if dir != "" {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read grok patterns dir: %v", err)
+		}
+
+		for _, entry := range entries {
+			if entry.Mode().IsRegular() {
+				paths = append(paths, filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+
+	paths = append(paths, files...)
+
+	// Parse definitions
+	definitions := make(map[string]string)
+	for _, path := range paths {
+		if err := readGrokPatternFile(path, definitions); err != nil {
+			return nil, err
+		}
+	}
+
+	return definitions, nil
+}
+
+// readGrokPatternFile adds the pattern definitions in the file to the definitions map
+func readGrokPatternFile(path string, definitions map[string]string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to open grok pattern file: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber += 1
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Split name from regex on the first run of whitespace
+		i := strings.IndexAny(line, " \t")
+		if i < 0 {
+			return fmt.Errorf("invalid grok pattern definition at %s:%d", path, lineNumber)
+		}
+
+		definitions[line[:i]] = strings.TrimSpace(line[i:])
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("unable to read grok pattern file: %v", err)
+	}
+
+	return nil
+}
+
+func parseEventWithGrokPatterns(event string, grokPatterns []string) (map[string]string, error) {
+	p, err := NewGrokParser(grokPatterns, nil, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return p.parseEvent(event)
+}
+
+func ParseGrok(event string, grokPatterns []string) ([]byte, error) {
+	p, err := NewGrokParser(grokPatterns, nil, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return p.Parse(event, nil)
+}
@@ -1,6 +1,10 @@
 package parser
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 )
 
@@ -37,4 +41,275 @@ func TestParseEventWithGrokPatterns(t *testing.T) {
 		}
 	}
 
-}
\ No newline at end of file
+}
+
+var grokBenchLog = `2020-01-29T21:26:10Z 10.10.10.10 PulseSecure: - - - 2020-01-29 21:26:10 - ibos1 - [4.4.4.4] user1(Com1-Reliable)[Com1-Reliable-Grp-TST] - Login succeeded for user1/Com1-Reliable (session:00000000) from 5.5.5.5 with Mozilla/4.0 (compatible; MSIE 8.0; Windows NT 6.1; Trident/4.0; .NET4.0C; .NET4.0E; .NET CLR 2.0.50727; .NET CLR 3.0.30729; .NET CLR 3.5.30729; wbx 1.0.0; Zoom 3.6.0).`
+var grokBenchPattern = `%{TIMESTAMP_ISO8601:timestamp} %{PROG:pulse_appliance} %{PROG:software}: - - - %{TIMESTAMP_ISO8601:timestamp2} - %{WORD:w1} - \[%{NOTSPACE:ip}\] %{GREEDYDATA:user}\[%{GREEDYDATA:group}\] - %{GREEDYDATA:logmsg}`
+
+func TestGrokParser(t *testing.T) {
+	grokPatterns := []string{`%{IP:client} %{WORD:method} %{URIPATHPARAM:request}`, `%{WORD:action} %{NUMBER:bytes}`, `^keepalive$`}
+
+	p, err := NewGrokParser(grokPatterns, nil, nil)
+
+	if err != nil {
+		t.Fatalf("failed to create grok parser: %v", err)
+	}
+
+	resultMap, err := p.parseEvent("55.3.244.1 GET /index.html")
+
+	if err != nil {
+		t.Fatalf("failed to parse Grok message: %v", err)
+	}
+
+	if resultMap["method"] != "GET" {
+		t.Errorf(`resultMap["method"] got %s; expected %s`, resultMap["method"], "GET")
+	}
+
+	resultMap, err = p.parseEvent("allow 1024")
+
+	if err != nil {
+		t.Fatalf("failed to fall back to second Grok pattern: %v", err)
+	}
+
+	if resultMap["bytes"] != "1024" {
+		t.Errorf(`resultMap["bytes"] got %s; expected %s`, resultMap["bytes"], "1024")
+	}
+
+	resultMap, err = p.parseEvent("keepalive")
+
+	if err != nil {
+		t.Fatalf("failed to match Grok pattern without captures: %v", err)
+	}
+
+	if len(resultMap) != 0 {
+		t.Errorf("resultMap got %v; expected no captures", resultMap)
+	}
+
+	if _, err := p.parseEvent("!!!"); err == nil {
+		t.Errorf("failed to error when no Grok pattern matches")
+	}
+}
+
+func TestGrokParserInvalidPattern(t *testing.T) {
+	if _, err := NewGrokParser([]string{`%{NOT_A_PATTERN:field}`}, nil, nil); err == nil {
+		t.Errorf("failed to error on unknown Grok pattern")
+	}
+
+	if _, err := NewGrokParser([]string{`%{WORD:field} (unclosed`}, nil, nil); err == nil {
+		t.Errorf("failed to error on invalid Grok regular expression")
+	}
+
+	if _, err := NewGrokParser([]string{}, nil, nil); err == nil {
+		t.Errorf("failed to error on empty Grok pattern list")
+	}
+}
+
+func TestGrokParserConcurrent(t *testing.T) {
+	p, err := NewGrokParser([]string{grokBenchPattern}, nil, nil)
+
+	if err != nil {
+		t.Fatalf("failed to create grok parser: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, err := p.Parse(grokBenchLog, nil); err != nil {
+					t.Errorf("failed to parse Grok message: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkParseGrok(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseGrok(grokBenchLog, []string{grokBenchPattern}); err != nil {
+			b.Fatalf("failed to parse Grok message: %v", err)
+		}
+	}
+}
+
+func BenchmarkGrokParser(b *testing.B) {
+	p, err := NewGrokParser([]string{grokBenchPattern}, nil, nil)
+
+	if err != nil {
+		b.Fatalf("failed to create grok parser: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.Parse(grokBenchLog, nil); err != nil {
+			b.Fatalf("failed to parse Grok message: %v", err)
+		}
+	}
+}
+
+func TestLoadGrokPatternDefinitions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grok-patterns")
+
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	grokPatternFile1 := "# Cisco patterns\n\nCISCO_REASON Duplicate address|(?:Interface|Host) down\nCISCO_ACTION %{WORD}\n"
+	grokPatternFile2 := "PAN_SESSION session %{INT:session_id:int}\n"
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "cisco"), []byte(grokPatternFile1), 0644); err != nil {
+		t.Fatalf("failed to write pattern file: %v", err)
+	}
+
+	extraFile := filepath.Join(dir, "..", filepath.Base(dir)+"-pan")
+	if err := ioutil.WriteFile(extraFile, []byte(grokPatternFile2), 0644); err != nil {
+		t.Fatalf("failed to write pattern file: %v", err)
+	}
+	defer os.Remove(extraFile)
+
+	definitions, err := LoadGrokPatternDefinitions(dir, []string{extraFile})
+
+	if err != nil {
+		t.Fatalf("failed to load grok pattern definitions: %v", err)
+	}
+
+	if len(definitions) != 3 {
+		t.Errorf("len(definitions) got %v; expected %v", len(definitions), 3)
+	}
+
+	p, err := NewGrokParser([]string{`%{CISCO_ACTION:action} %{CISCO_REASON:reason}`, `%{PAN_SESSION}`}, definitions, nil)
+
+	if err != nil {
+		t.Fatalf("failed to create grok parser with custom patterns: %v", err)
+	}
+
+	resultMap, err := p.parseEvent("deny Interface down")
+
+	if err != nil {
+		t.Fatalf("failed to parse Grok message: %v", err)
+	}
+
+	if resultMap["reason"] != "Interface down" {
+		t.Errorf(`resultMap["reason"] got %s; expected %s`, resultMap["reason"], "Interface down")
+	}
+
+	resultMap, err = p.parseEvent("session 42")
+
+	if err != nil {
+		t.Fatalf("failed to parse Grok message: %v", err)
+	}
+
+	if resultMap["session_id"] != "42" {
+		t.Errorf(`resultMap["session_id"] got %s; expected %s`, resultMap["session_id"], "42")
+	}
+}
+
+func TestLoadGrokPatternDefinitionsInvalid(t *testing.T) {
+	file, err := ioutil.TempFile("", "grok-patterns")
+
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.WriteString("MISSING_REGEX\n"); err != nil {
+		t.Fatalf("failed to write pattern file: %v", err)
+	}
+	file.Close()
+
+	if _, err := LoadGrokPatternDefinitions("", []string{file.Name()}); err == nil {
+		t.Errorf("failed to error on invalid grok pattern definition")
+	}
+
+	if _, err := LoadGrokPatternDefinitions("/does/not/exist", nil); err == nil {
+		t.Errorf("failed to error on missing grok patterns dir")
+	}
+
+	if _, err := NewGrokParser([]string{`%{WORD:w}`}, map[string]string{"BROKEN": `%{NOT_A_PATTERN}`}, nil); err == nil {
+		t.Errorf("failed to error on grok pattern definition referencing unknown pattern")
+	}
+}
+
+func TestGrokParserTyped(t *testing.T) {
+	grokPatterns := []string{`%{IP:client} %{NUMBER:bytes:int} %{NUMBER:duration:float} %{WORD:cached:bool} %{NUMBER:port}`}
+
+	p, err := NewGrokParser(grokPatterns, nil, map[string]string{"port": "int"})
+
+	if err != nil {
+		t.Fatalf("failed to create grok parser: %v", err)
+	}
+
+	resultMap, err := p.parseTypedEvent("55.3.244.1 15824 0.043 true 8080")
+
+	if err != nil {
+		t.Fatalf("failed to parse Grok message: %v", err)
+	}
+
+	grokExpectedValues := map[string]interface{}{
+		"client":   "55.3.244.1",
+		"bytes":    int64(15824),
+		"duration": 0.043,
+		"cached":   true,
+		"port":     int64(8080),
+	}
+
+	for k, v := range grokExpectedValues {
+		if resultMap[k] != v {
+			t.Errorf(`resultMap["%s"] got %v (%T); expected %v (%T)`, k, resultMap[k], resultMap[k], v, v)
+		}
+	}
+
+	// Values that cannot be converted are kept as strings
+	resultMap, err = p.parseTypedEvent("55.3.244.1 15824 0.043 maybe 8080")
+
+	if err != nil {
+		t.Fatalf("failed to parse Grok message: %v", err)
+	}
+
+	if resultMap["cached"] != "maybe" {
+		t.Errorf(`resultMap["cached"] got %v; expected %s`, resultMap["cached"], "maybe")
+	}
+
+	jsonString, err := p.Parse("55.3.244.1 15824 0.043 false 8080", nil)
+
+	if err != nil {
+		t.Fatalf("failed to parse Grok message: %v", err)
+	}
+
+	expectedJson := `{"bytes":15824,"cached":false,"client":"55.3.244.1","duration":0.043,"port":8080}`
+	if string(jsonString) != expectedJson {
+		t.Errorf("p.Parse() got %s; expected %s", jsonString, expectedJson)
+	}
+}
+
+func TestGrokParserTypedDefinitions(t *testing.T) {
+	definitions := map[string]string{"PAN_SESSION": `session %{INT:session_id:int}`}
+
+	p, err := NewGrokParser([]string{`%{PAN_SESSION} %{WORD:action}`}, definitions, nil)
+
+	if err != nil {
+		t.Fatalf("failed to create grok parser: %v", err)
+	}
+
+	resultMap, err := p.parseTypedEvent("session 42 allow")
+
+	if err != nil {
+		t.Fatalf("failed to parse Grok message: %v", err)
+	}
+
+	if resultMap["session_id"] != int64(42) {
+		t.Errorf(`resultMap["session_id"] got %v (%T); expected %v`, resultMap["session_id"], resultMap["session_id"], 42)
+	}
+
+	if _, err := NewGrokParser([]string{`%{NUMBER:bytes:long}`}, nil, nil); err == nil {
+		t.Errorf("failed to error on invalid grok type hint")
+	}
+
+	if _, err := NewGrokParser([]string{`%{NUMBER:bytes}`}, nil, map[string]string{"bytes": "long"}); err == nil {
+		t.Errorf("failed to error on invalid grok field type")
+	}
+}
@@ -3,18 +3,226 @@ package parser
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 )
 
-// ParseJson will convert raw string to JSON
+// jsonCeeCookie marks a CEE (Lumberjack) JSON payload
+const jsonCeeCookie = "@cee:"
+
+func init() {
+	Register("json", func(config *Config) (Parser, error) {
+		prefixField := config.JsonPrefixField
+		if prefixField == "" {
+			prefixField = defaultJsonParser.prefixField
+		}
+
+		return &JsonParser{prefixField: prefixField, decodeNested: config.JsonDecodeNested}, nil
+	})
+}
+
+// defaultJsonParser extracts embedded JSON objects without decoding nested JSON strings
+var defaultJsonParser = &JsonParser{prefixField: "prefix"}
+
+// JsonParser parses JSON messages and JSON objects embedded after a prefix such as a program tag
+// or the @cee: cookie
+type JsonParser struct {
+	prefixField  string
+	decodeNested bool
+}
+
+func (p *JsonParser) Name() string {
+	return "json"
+}
+
+// Parse returns the message as is when it is a JSON object, and an error when it is any other JSON
+// value. Otherwise the first complete JSON object in the message is extracted (ignoring any text after
+// it) and the text before it (without any @cee: cookie) is added to the prefix field, unless the object
+// already has that field. Objects inside an enclosing array or string are not extracted.
+func (p *JsonParser) Parse(message string, _ map[string]interface{}) ([]byte, error) {
+	prefix := ""
+	payload := message
+
+	if !isJSONObject(message) {
+		// Other JSON values are not searched for objects
+		if json.Valid([]byte(message)) {
+			return nil, fmt.Errorf("json value is not an object")
+		}
+
+		start, end := jsonObjectIndex(message)
+
+		if start < 0 || jsonEnclosed(message, start) {
+			return nil, fmt.Errorf("string is not in json format")
+		}
+
+		payload = message[start:end]
+		prefix = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(message[:start]), jsonCeeCookie))
+	}
+
+	if prefix == "" && !p.decodeNested {
+		return []byte(payload), nil
+	}
+
+	// Decode the payload to modify it
+	var event interface{}
+	decoder := json.NewDecoder(strings.NewReader(payload))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&event); err != nil {
+		return nil, fmt.Errorf("string is not in json format: %v", err)
+	}
+
+	if p.decodeNested {
+		event = decodeNestedJson(event)
+	}
+
+	if object, ok := event.(map[string]interface{}); ok && prefix != "" {
+		if _, exists := object[p.prefixField]; !exists {
+			object[p.prefixField] = prefix
+		}
+	}
+
+	// Marshal JSON string
+	return json.Marshal(event)
+}
+
+// ParseJson will convert raw string to JSON, extracting a JSON object embedded after a prefix
 func ParseJson(event string) ([]byte, error) {
-	if !isJSON(event) {
-		return nil, fmt.Errorf("string is not in json format")
+	return defaultJsonParser.Parse(event, nil)
+}
+
+// isJSONObject returns whether the string is a JSON object. Other JSON values (arrays, strings,
+// numbers) cannot carry the fields added to events, so they are not accepted.
+func isJSONObject(str string) bool {
+	return strings.HasPrefix(strings.TrimSpace(str), "{") && json.Valid([]byte(str))
+}
+
+// jsonMaxCandidates bounds the number of brace delimited spans validated when looking for an embedded
+// JSON object
+const jsonMaxCandidates = 16
+
+// jsonObjectIndex returns the start and end index of the first complete JSON object in the message, or
+// -1, -1. The message is scanned once to pair the braces (skipping braces in strings) and at most
+// jsonMaxCandidates of the paired spans are validated, so the cost stays linear in the message size.
+func jsonObjectIndex(message string) (int, int) {
+	starts := make([]int, 0)
+	candidates := make([][2]int, 0)
+	inString, escaped := false, false
+
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+
+		// Skip the content of strings inside braces
+		if inString {
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = len(starts) > 0
+		case '{':
+			starts = append(starts, i)
+		case '}':
+			if len(starts) > 0 {
+				candidates = append(candidates, [2]int{starts[len(starts)-1], i + 1})
+				starts = starts[:len(starts)-1]
+			}
+		}
 	}
-	jsonMessage := []byte(event)
-	return jsonMessage, nil
+
+	// Try the outermost spans first, in the order they start
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i][0] < candidates[j][0] })
+
+	for i, candidate := range candidates {
+		if i == jsonMaxCandidates {
+			break
+		}
+
+		if json.Valid([]byte(message[candidate[0]:candidate[1]])) {
+			return candidate[0], candidate[1]
+		}
+	}
+
+	return -1, -1
 }
 
-func isJSON(str string) bool {
-	var js json.RawMessage
-	return json.Unmarshal([]byte(str), &js) == nil
-}
\ No newline at end of file
+// jsonEnclosed returns whether the index is inside the array or string that the message starts with,
+// such as the elements of a truncated JSON array
+func jsonEnclosed(message string, index int) bool {
+	first := len(message) - len(strings.TrimLeft(message, " \t\r\n"))
+	if first >= index || (message[first] != '[' && message[first] != '"') {
+		return false
+	}
+
+	depth := 0
+	inString, escaped := false, false
+
+	for i := first; i < index; i++ {
+		c := message[i]
+
+		if inString {
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+				if depth == 0 {
+					return false
+				}
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = true
+		case '[', '{':
+			depth++
+		case ']', '}':
+			if depth--; depth == 0 {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// decodeNestedJson replaces string values that hold a JSON object or array with their decoded value
+func decodeNestedJson(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, nested := range v {
+			v[k] = decodeNestedJson(nested)
+		}
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = decodeNestedJson(nested)
+		}
+	case string:
+		trimmed := strings.TrimSpace(v)
+		if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") || !json.Valid([]byte(trimmed)) {
+			return v
+		}
+
+		var decoded interface{}
+		decoder := json.NewDecoder(strings.NewReader(trimmed))
+		decoder.UseNumber()
+
+		if err := decoder.Decode(&decoded); err != nil {
+			return v
+		}
+
+		return decodeNestedJson(decoded)
+	}
+
+	return value
+}
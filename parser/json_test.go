@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+var jsonMessage1 = `{"level":"info","msg":"started"}`
+var jsonMessage2 = `myapp[123]: {"level":"info","msg":"started {worker}"}`
+var jsonMessage3 = `@cee: {"level":"warn","count":12345678901234567890}`
+var jsonMessage4 = `{"level":"info","payload":"{\"user\":\"bob\",\"roles\":\"[\\\"admin\\\"]\"}","note":"{not json"}`
+
+func TestParseJson(t *testing.T) {
+	jsonExpectedValues := [][]string{
+		{jsonMessage1, jsonMessage1},
+		{jsonMessage2, `{"level":"info","msg":"started {worker}","prefix":"myapp[123]:"}`},
+		{jsonMessage3, `{"level":"warn","count":12345678901234567890}`},
+		{`myapp: @cee: {"prefix":"kept"}`, `{"prefix":"kept"}`},
+		{`myapp: {"level":"info"} trailing`, `{"level":"info","prefix":"myapp:"}`},
+		{`myapp: {"msg":"a } \" { b"} trailing }`, `{"msg":"a } \" { b","prefix":"myapp:"}`},
+		{`{{ {not json} myapp: {"a":{"b":1}}} {"c":2}`, `{"a":{"b":1},"prefix":"{{ {not json} myapp:"}`},
+		{`[INFO] {"level":"info"}`, `{"level":"info","prefix":"[INFO]"}`},
+		{`"myapp" {"level":"info"}`, `{"level":"info","prefix":"\"myapp\""}`},
+	}
+
+	for _, v := range jsonExpectedValues {
+		result, err := ParseJson(v[0])
+
+		if err != nil {
+			t.Fatalf("failed to parse JSON message: %v", err)
+		}
+
+		if string(result) != v[1] {
+			t.Errorf("ParseJson(%s) got %s; expected %s", v[0], result, v[1])
+		}
+	}
+
+	invalidMessages := []string{
+		"not json",
+		`myapp: {"level":`,
+		`[1,2,3]`,
+		`[{"a":1},{"b":2}]`,
+		`[{"a":1},{"b":`,
+		`12345`,
+		`"text"`,
+		`"text {\"a\":1}"`,
+		`["x", {"a":1}`,
+		`null`,
+	}
+
+	for _, v := range invalidMessages {
+		if _, err := ParseJson(v); err == nil {
+			t.Errorf("failed to error on invalid JSON message: %s", v)
+		}
+	}
+}
+
+func TestParseJsonDecodeNested(t *testing.T) {
+	p, err := New("json", &Config{JsonPrefixField: "program", JsonDecodeNested: true})
+
+	if err != nil {
+		t.Fatalf("failed to create json parser: %v", err)
+	}
+
+	jsonExpectedValues := [][]string{
+		{jsonMessage4, `{"level":"info","note":"{not json","payload":{"roles":["admin"],"user":"bob"}}`},
+		{"app: " + jsonMessage3, `{"count":12345678901234567890,"level":"warn","program":"app:"}`},
+	}
+
+	for _, v := range jsonExpectedValues {
+		result, err := p.Parse(v[0], nil)
+
+		if err != nil {
+			t.Fatalf("failed to parse JSON message: %v", err)
+		}
+
+		if string(result) != v[1] {
+			t.Errorf("p.Parse(%s) got %s; expected %s", v[0], result, v[1])
+		}
+	}
+}
+
+func BenchmarkParseJsonUnterminated(b *testing.B) {
+	message := "x " + strings.Repeat(`{"a":`, 12000)
+
+	for n := 0; n < b.N; n++ {
+		_, _ = ParseJson(message)
+	}
+}
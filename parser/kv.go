@@ -3,38 +3,97 @@ package parser
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/jjeffery/kv"
+	"strings"
 )
 
-// parseKeyValue will take a key value formatted string and convert it into a key value map
-func parseKeyValue(event string, cef bool) (map[string]string, error) {
-	// Use KeyValue library to parse
-	text, list := kv.Parse([]byte(event))
+// KV duplicate key policies
+const (
+	kvDuplicateLast  = "last"
+	kvDuplicateFirst = "first"
+	kvDuplicateArray = "array"
+)
+
+// kvNoQuotes disables quoting of KV keys and values
+const kvNoQuotes = "none"
+
+func init() {
+	Register("kv", func(config *Config) (Parser, error) {
+		return NewKVParser(config)
+	})
+}
+
+// defaultKVParser parses whitespace separated key=value pairs with double quoted values
+var defaultKVParser = &KVParser{
+	pairSeparator:  " ",
+	valueSeparator: "=",
+	quotes:         `"`,
+	duplicateKeys:  kvDuplicateLast,
+}
 
-	// If return text then an error occurred during parsing
-	if len(text) > 0 {
-		return nil, fmt.Errorf(`invalid key value format at: "%s"`, string(text))
+// KVParser parses key value messages with configurable separators, quoting and duplicate key handling
+type KVParser struct {
+	pairSeparator  string
+	valueSeparator string
+	quotes         string
+	trim           bool
+	duplicateKeys  string
+	remainderField string
+}
+
+// NewKVParser creates a key value parser from the KV settings in the config. Empty separators, quotes
+// and duplicate key policy fall back to the defaults (space, equals, double quotes and last wins). Quoting
+// is disabled with the quotes "none". A space pair separator splits pairs on any whitespace.
+func NewKVParser(config *Config) (*KVParser, error) {
+	p := &KVParser{
+		pairSeparator:  config.KvPairSeparator,
+		valueSeparator: config.KvValueSeparator,
+		quotes:         config.KvQuotes,
+		trim:           config.KvTrim,
+		duplicateKeys:  config.KvDuplicateKeys,
+		remainderField: config.KvRemainderField,
 	}
 
-	// Convert from list to a map
-	elementMap := make(map[string]string)
-	for i := 0; i < len(list); i += 2 {
-		key := list[i].(string)
-		value := list[i+1].(string)
-		if cef {
-			elementMap[cefEscapeExtension(key)] = cefEscapeExtension(value)
-		} else {
-			elementMap[key] = value
-		}
+	if p.pairSeparator == "" {
+		p.pairSeparator = defaultKVParser.pairSeparator
 	}
 
-	return elementMap, nil
+	if p.valueSeparator == "" {
+		p.valueSeparator = defaultKVParser.valueSeparator
+	}
+
+	if p.quotes == "" {
+		p.quotes = defaultKVParser.quotes
+	} else if p.quotes == kvNoQuotes {
+		p.quotes = ""
+	}
+
+	if p.duplicateKeys == "" {
+		p.duplicateKeys = defaultKVParser.duplicateKeys
+	}
+
+	// Validate settings
+	if p.pairSeparator == p.valueSeparator {
+		return nil, fmt.Errorf("kv pair separator and value separator must differ")
+	}
+
+	if strings.ContainsAny(p.quotes, p.pairSeparator+p.valueSeparator) {
+		return nil, fmt.Errorf("kv quote characters must not contain the separators")
+	}
+
+	if !contains([]string{kvDuplicateLast, kvDuplicateFirst, kvDuplicateArray}, p.duplicateKeys) {
+		return nil, fmt.Errorf("invalid kv duplicate key policy: %s (last, first or array)", p.duplicateKeys)
+	}
+
+	return p, nil
 }
 
-// ConstructKeyValue will take a key value formatted string and convert it into a key value json object
-func ParseKV(event string) ([]byte, error) {
+func (p *KVParser) Name() string {
+	return "kv"
+}
+
+func (p *KVParser) Parse(message string, _ map[string]interface{}) ([]byte, error) {
 	// Parse key value string
-	result, err := parseKeyValue(event, false)
+	result, err := p.parseEvent(message)
 
 	// Handle errors
 	if err != nil {
@@ -42,12 +101,160 @@ func ParseKV(event string) ([]byte, error) {
 	}
 
 	// Marshal JSON string
-	jsonString, err := json.Marshal(result)
+	return json.Marshal(result)
+}
 
-	// Handle errors
-	if err != nil {
-		return nil, err
+// parseEvent splits the event into pairs and returns the key value map. Text that is not a key value
+// pair is an error, unless a remainder field is set in which case it is collected into that field.
+// Unterminated quotes are always an error.
+func (p *KVParser) parseEvent(event string) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	remainder := make([]string, 0)
+
+	if p.index(event, "") == -2 {
+		return nil, fmt.Errorf(`invalid key value format: unterminated quote in "%s"`, event)
+	}
+
+	for len(event) > 0 {
+		// Split off the next pair
+		pair := event
+		event = ""
+		if i := p.index(pair, p.pairSeparator); i >= 0 {
+			pair, event = pair[:i], pair[i+p.separatorLength(pair[i:], p.pairSeparator):]
+		}
+
+		if p.trim {
+			pair = strings.TrimSpace(pair)
+		}
+
+		if pair == "" {
+			continue
+		}
+
+		// Split the key and value
+		i := p.index(pair, p.valueSeparator)
+		key := ""
+		if i > 0 {
+			key = p.unquote(pair[:i])
+		}
+
+		if p.trim {
+			key = strings.TrimSpace(key)
+		}
+
+		// Values may not start with another value separator (key==value)
+		if key != "" && strings.HasPrefix(pair[i+len(p.valueSeparator):], p.valueSeparator) {
+			key = ""
+		}
+
+		if key == "" {
+			if p.remainderField == "" {
+				return nil, fmt.Errorf(`invalid key value format at: "%s"`, pair)
+			}
+			remainder = append(remainder, pair)
+			continue
+		}
+
+		value := pair[i+len(p.valueSeparator):]
+		if p.trim {
+			value = strings.TrimSpace(value)
+		}
+
+		p.add(result, key, p.unquote(value))
+	}
+
+	if len(remainder) > 0 {
+		p.add(result, p.remainderField, strings.Join(remainder, p.pairSeparator))
+	}
+
+	return result, nil
+}
+
+// index returns the index of the first separator outside of quotes, -1 if there is none or -2 if a
+// quote is left unterminated. A space separator matches any whitespace and an empty separator never
+// matches.
+func (p *KVParser) index(s, separator string) int {
+	var quote byte
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != 0 && s[i] == '\\':
+			i++
+		case quote != 0 && s[i] == quote:
+			quote = 0
+		case quote != 0:
+		case strings.IndexByte(p.quotes, s[i]) >= 0:
+			quote = s[i]
+		case separator == " " && isKVSpace(s[i]):
+			return i
+		case separator != "" && strings.HasPrefix(s[i:], separator):
+			return i
+		}
+	}
+
+	if quote != 0 {
+		return -2
+	}
+
+	return -1
+}
+
+// separatorLength returns the length of the separator at the start of s
+func (p *KVParser) separatorLength(s, separator string) int {
+	if separator == " " && isKVSpace(s[0]) {
+		return 1
 	}
 
-	return jsonString, nil
+	return len(separator)
+}
+
+// isKVSpace returns whether the byte is whitespace
+func isKVSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+// unquote removes the surrounding quotes and unescapes a quoted string
+func (p *KVParser) unquote(s string) string {
+	if len(s) < 2 || strings.IndexByte(p.quotes, s[0]) < 0 || s[len(s)-1] != s[0] {
+		return s
+	}
+
+	replacer := strings.NewReplacer(
+		`\\`, `\`,
+		`\`+s[:1], s[:1],
+	)
+
+	return replacer.Replace(s[1 : len(s)-1])
+}
+
+// add sets the key in the result according to the duplicate key policy
+func (p *KVParser) add(result map[string]interface{}, key, value string) {
+	existing, ok := result[key]
+
+	if !ok {
+		result[key] = value
+		return
+	}
+
+	switch p.duplicateKeys {
+	case kvDuplicateFirst:
+	case kvDuplicateArray:
+		if values, ok := existing.([]string); ok {
+			result[key] = append(values, value)
+		} else {
+			result[key] = []string{existing.(string), value}
+		}
+	default:
+		result[key] = value
+	}
+}
+
+// parseKeyValue will take a whitespace separated key=value formatted string and convert it into a key value map
+func parseKeyValue(event string) (map[string]interface{}, error) {
+	return defaultKVParser.parseEvent(event)
+}
+
+// ParseKV will take a whitespace separated key=value formatted string and convert it into a key value json object
+func ParseKV(event string) ([]byte, error) {
+	return defaultKVParser.Parse(event, nil)
 }
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"fmt"
 	"github.com/jjeffery/kv"
 	"testing"
 )
@@ -22,7 +23,7 @@ func TestParseKV(t *testing.T) {
 		t.Fatalf("len(list) got %v; expected %v", len(list), kvExpectedLength)
 	}
 
-	resultMap, err := parseKeyValue(string(kvMessage1), false)
+	resultMap, err := parseKeyValue(string(kvMessage1))
 
 	if err != nil {
 		t.Fatalf("failed to parse KV message")
@@ -36,11 +37,158 @@ func TestParseKV(t *testing.T) {
 }
 
 func TestParseKV2(t *testing.T) {
-	if text, _ := kv.Parse(kvMessage2); text == nil {
-		t.Errorf("failed to error on invalid KV message")
+	invalidMessages := []string{
+		string(kvMessage2),
+		string(kvMessage3),
+		`a="unterminated b=2`,
+		`a=1 b="unterminated`,
+	}
+
+	for _, message := range invalidMessages {
+		if _, err := ParseKV(message); err == nil {
+			t.Errorf("ParseKV(%q) failed to error on invalid KV message", message)
+		}
+	}
+}
+
+func TestParseKVWhitespace(t *testing.T) {
+	resultMap, err := parseKeyValue("a=1\tb=2\r\n c=\"x\ty\"  d=4")
+
+	if err != nil {
+		t.Fatalf("failed to parse KV message: %v", err)
 	}
 
-	if text, _ := kv.Parse(kvMessage3); text == nil {
+	kvExpectedKeyValues := [][]string{{"a", "1"}, {"b", "2"}, {"c", "x\ty"}, {"d", "4"}}
+
+	if len(resultMap) != len(kvExpectedKeyValues) {
+		t.Errorf("len(resultMap) got %v; expected %v", len(resultMap), len(kvExpectedKeyValues))
+	}
+
+	for _, v := range kvExpectedKeyValues {
+		if resultMap[v[0]] != v[1] {
+			t.Errorf(`resultMap["%s"] got %v; expected %s`, v[0], resultMap[v[0]], v[1])
+		}
+	}
+}
+
+var kvMessage4 = `date=2020-09-16 time=12:00:00 devname="FG100 east" msg="quoted \"value\"" action=deny`
+var kvMessage5 = `src:10.0.0.1; dst:10.0.0.2; user:"a;b"; tag:x; tag:y`
+
+func TestKVParser(t *testing.T) {
+	p, err := NewKVParser(&Config{KvQuotes: `"`})
+
+	if err != nil {
+		t.Fatalf("failed to create kv parser: %v", err)
+	}
+
+	resultMap, err := p.parseEvent(kvMessage4)
+
+	if err != nil {
+		t.Fatalf("failed to parse KV message: %v", err)
+	}
+
+	kvExpectedKeyValues := [][]string{{"time", "12:00:00"}, {"devname", "FG100 east"}, {"msg", `quoted "value"`}, {"action", "deny"}}
+
+	for _, v := range kvExpectedKeyValues {
+		if resultMap[v[0]] != v[1] {
+			t.Errorf(`p.parseEvent(message4)["%s"] got %v; expected %s`, v[0], resultMap[v[0]], v[1])
+		}
+	}
+
+	if _, err := p.parseEvent(string(kvMessage2)); err == nil {
 		t.Errorf("failed to error on invalid KV message")
 	}
-}
\ No newline at end of file
+}
+
+func TestKVParserQuotes(t *testing.T) {
+	tests := []struct {
+		config *Config
+		quoted bool
+	}{
+		{nil, true},
+		{&Config{}, true},
+		{&Config{KvQuotes: "'"}, false},
+		{&Config{KvQuotes: "none"}, false},
+	}
+
+	for _, test := range tests {
+		p, err := New("kv", test.config)
+
+		if err != nil {
+			t.Fatalf("failed to create kv parser: %v", err)
+		}
+
+		// Without double quotes the value is split at the space, leaving text that is not a pair
+		jsonString, err := p.Parse(`a=1 b="x y"`, nil)
+
+		if test.quoted && (err != nil || string(jsonString) != `{"a":"1","b":"x y"}`) {
+			t.Errorf("p.Parse() with %+v got %s, %v; expected the quoted value", test.config, jsonString, err)
+		} else if !test.quoted && err == nil {
+			t.Errorf("p.Parse() with %+v got %s; expected the double quotes to be ignored", test.config, jsonString)
+		}
+	}
+}
+
+func TestKVParserSeparators(t *testing.T) {
+	policies := map[string]interface{}{
+		"last":  "y",
+		"first": "x",
+		"array": []string{"x", "y"},
+	}
+
+	for policy, expected := range policies {
+		p, err := NewKVParser(&Config{KvPairSeparator: ";", KvValueSeparator: ":", KvQuotes: `"`, KvTrim: true, KvDuplicateKeys: policy})
+
+		if err != nil {
+			t.Fatalf("failed to create kv parser: %v", err)
+		}
+
+		resultMap, err := p.parseEvent(kvMessage5)
+
+		if err != nil {
+			t.Fatalf("failed to parse KV message: %v", err)
+		}
+
+		if resultMap["dst"] != "10.0.0.2" || resultMap["user"] != "a;b" {
+			t.Errorf("p.parseEvent(message5) got %v; expected dst and user fields", resultMap)
+		}
+
+		if fmt.Sprint(resultMap["tag"]) != fmt.Sprint(expected) {
+			t.Errorf(`p.parseEvent(message5)["tag"] with %s policy got %v; expected %v`, policy, resultMap["tag"], expected)
+		}
+	}
+}
+
+func TestKVParserRemainder(t *testing.T) {
+	p, err := NewKVParser(&Config{KvRemainderField: "remainder"})
+
+	if err != nil {
+		t.Fatalf("failed to create kv parser: %v", err)
+	}
+
+	resultMap, err := p.parseEvent(string(kvMessage2))
+
+	if err != nil {
+		t.Fatalf("failed to parse KV message: %v", err)
+	}
+
+	if resultMap["remainder"] != "message this stuff" {
+		t.Errorf(`p.parseEvent(message2)["remainder"] got %v; expected %s`, resultMap["remainder"], "message this stuff")
+	}
+
+	if resultMap["dvc"] != "10.118.182.162" {
+		t.Errorf(`p.parseEvent(message2)["dvc"] got %v; expected %s`, resultMap["dvc"], "10.118.182.162")
+	}
+
+	invalidConfigs := []*Config{
+		{KvPairSeparator: "=", KvValueSeparator: "="},
+		{KvQuotes: "="},
+		{KvDuplicateKeys: "merge"},
+	}
+
+	for _, config := range invalidConfigs {
+		if _, err := NewKVParser(config); err == nil {
+			t.Errorf("failed to error on invalid kv config: %+v", config)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type LeefEvent struct {
+	Version        string
+	Vendor         string
+	Product        string
+	ProductVersion string
+	EventID        string
+	Attributes     map[string]string
+}
+
+func init() {
+	Register("leef", func(config *Config) (Parser, error) {
+		return &funcParser{name: "leef", parse: func(message string, _ map[string]interface{}) ([]byte, error) {
+			return ParseLeef(message)
+		}}, nil
+	})
+}
+
+func ParseLeef(event string) ([]byte, error) {
+	leefEvent, err := leefStringToObject(event)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Marshal JSON string
+	return json.Marshal(leefEvent)
+}
+
+func leefStringToObject(leefString string) (*LeefEvent, error) {
+	leefString = strings.TrimSpace(leefString)
+
+	// Validate that it is a valid LEEF message
+	if !strings.HasPrefix(leefString, "LEEF:") {
+		return nil, fmt.Errorf("invalid LEEF format")
+	}
+
+	// Split header fields (LEEF:Version|Vendor|Product|Version|EventID|...)
+	arr := splitHeader(leefString[len("LEEF:"):], 5)
+
+	if len(arr) < 5 {
+		return nil, fmt.Errorf("invalid LEEF format")
+	}
+
+	version := arr[0]
+	attributes := ""
+	if len(arr) > 5 {
+		attributes = arr[5]
+	}
+
+	// LEEF 1.0 attributes are always tab delimited
+	delimiter := "\t"
+
+	if strings.HasPrefix(version, "2") {
+		// LEEF 2.0 adds an optional delimiter field before the attributes
+		rest := splitHeader(attributes, 1)
+		if len(rest) == 2 && !strings.Contains(rest[0], "=") {
+			d, err := leefDelimiter(rest[0])
+			if err != nil {
+				return nil, err
+			}
+			delimiter = d
+			attributes = rest[1]
+		}
+	} else if !strings.HasPrefix(version, "1") {
+		return nil, fmt.Errorf("invalid LEEF format: unsupported version %s", version)
+	}
+
+	// Build LEEF event
+	leefEvent := &LeefEvent{
+		Version:        version,
+		Vendor:         leefEscapeField(arr[1]),
+		Product:        leefEscapeField(arr[2]),
+		ProductVersion: leefEscapeField(arr[3]),
+		EventID:        leefEscapeField(arr[4]),
+		Attributes:     leefParseAttributes(attributes, delimiter),
+	}
+
+	return leefEvent, nil
+}
+
+// leefDelimiter decodes the LEEF 2.0 delimiter field, which is either a single character or a
+// hex code point (x09 or 0x09). An empty field defaults to tab.
+func leefDelimiter(field string) (string, error) {
+	if field == "" {
+		return "\t", nil
+	}
+
+	lower := strings.ToLower(field)
+	if len(field) > 1 && (strings.HasPrefix(lower, "x") || strings.HasPrefix(lower, "0x")) {
+		code, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimPrefix(lower, "0"), "x"), 16, 32)
+		if err != nil {
+			return "", fmt.Errorf("invalid LEEF delimiter: %s", field)
+		}
+		return string(rune(code)), nil
+	}
+
+	if len([]rune(field)) != 1 {
+		return "", fmt.Errorf("invalid LEEF delimiter: %s", field)
+	}
+
+	return field, nil
+}
+
+// leefParseAttributes splits the delimited key=value attributes into a map
+func leefParseAttributes(attributes, delimiter string) map[string]string {
+	attributeMap := make(map[string]string)
+
+	for _, pair := range strings.Split(attributes, delimiter) {
+		kv := strings.SplitN(pair, "=", 2)
+		key := strings.TrimSpace(kv[0])
+
+		if len(kv) != 2 || key == "" {
+			continue
+		}
+
+		attributeMap[key] = strings.TrimRight(kv[1], "\r\n")
+	}
+
+	return attributeMap
+}
+
+// Unescape LEEF header fields
+func leefEscapeField(field string) string {
+
+	replacer := strings.NewReplacer(
+		"\\\\", "\\",
+		"\\|", "|",
+	)
+
+	return replacer.Replace(field)
+}
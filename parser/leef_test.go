@@ -0,0 +1,130 @@
+package parser
+
+import "testing"
+
+var leefMessage1 = "LEEF:1.0|Microsoft|MSExchange|4.0 SP1|15345|src=10.50.1.1\tdst=2.10.20.20\tspt=1200\tusrName=joe.bloggs"
+var leefMessage2 = "LEEF:2.0|Lancope|StealthWatch|1.0|41|^|src=10.0.1.8^dst=10.0.0.5^sev=5^srcPort=81^dstPort=21"
+var leefMessage3 = "LEEF:2.0|Imperva|SecureSphere|12.0|Firewall Alert|x09|cat=Firewall\tdevTime=Sep 16 2020 12:00:00\tmsg=blocked a=b request"
+var leefMessage4 = "CEF:0|Cool Vendor|Cool Product|1.0|FLAKY_EVENT|Something flaky happened.|3|sourceAddress=127.0.0.1"
+var leefMessage5 = "LEEF:2.0|Vendor\\|Inc|Product|1.0|Event|src=10.0.0.1\tdst=10.0.0.2"
+
+func TestParseLeef(t *testing.T) {
+	expectedVersion := "1.0"
+	expectedVendor := "Microsoft"
+	expectedProductVersion := "4.0 SP1"
+	expectedEventID := "15345"
+	leefExpectedKeyValues := [][]string{{"src", "10.50.1.1"}, {"spt", "1200"}, {"usrName", "joe.bloggs"}}
+
+	if _, err := ParseLeef(leefMessage1); err != nil {
+		t.Fatalf("failed to parse LEEF message: %v", err)
+	}
+
+	leefObj, err := leefStringToObject(leefMessage1)
+
+	if err != nil {
+		t.Fatalf("failed to parse LEEF message: %v", err)
+	}
+
+	if leefObj.Version != expectedVersion {
+		t.Errorf("leefStringToObject(message1).Version got %s; expected %s", leefObj.Version, expectedVersion)
+	}
+
+	if leefObj.Vendor != expectedVendor {
+		t.Errorf("leefStringToObject(message1).Vendor got %s; expected %s", leefObj.Vendor, expectedVendor)
+	}
+
+	if leefObj.ProductVersion != expectedProductVersion {
+		t.Errorf("leefStringToObject(message1).ProductVersion got %s; expected %s", leefObj.ProductVersion, expectedProductVersion)
+	}
+
+	if leefObj.EventID != expectedEventID {
+		t.Errorf("leefStringToObject(message1).EventID got %s; expected %s", leefObj.EventID, expectedEventID)
+	}
+
+	for _, v := range leefExpectedKeyValues {
+		if leefObj.Attributes[v[0]] != v[1] {
+			t.Errorf(`leefStringToObject(message1).Attributes["%s"] got %s; expected %s`, v[0], leefObj.Attributes[v[0]], v[1])
+		}
+	}
+}
+
+func TestParseLeef2(t *testing.T) {
+	expectedVersion := "2.0"
+	expectedProduct := "StealthWatch"
+	leefExpectedKeyValues := [][]string{{"src", "10.0.1.8"}, {"dst", "10.0.0.5"}, {"dstPort", "21"}}
+
+	leefObj, err := leefStringToObject(leefMessage2)
+
+	if err != nil {
+		t.Fatalf("failed to parse LEEF message: %v", err)
+	}
+
+	if leefObj.Version != expectedVersion {
+		t.Errorf("leefStringToObject(message2).Version got %s; expected %s", leefObj.Version, expectedVersion)
+	}
+
+	if leefObj.Product != expectedProduct {
+		t.Errorf("leefStringToObject(message2).Product got %s; expected %s", leefObj.Product, expectedProduct)
+	}
+
+	if len(leefObj.Attributes) != 5 {
+		t.Errorf("len(leefStringToObject(message2).Attributes) got %v; expected %v", len(leefObj.Attributes), 5)
+	}
+
+	for _, v := range leefExpectedKeyValues {
+		if leefObj.Attributes[v[0]] != v[1] {
+			t.Errorf(`leefStringToObject(message2).Attributes["%s"] got %s; expected %s`, v[0], leefObj.Attributes[v[0]], v[1])
+		}
+	}
+}
+
+func TestParseLeef3(t *testing.T) {
+	leefExpectedKeyValues := [][]string{{"cat", "Firewall"}, {"devTime", "Sep 16 2020 12:00:00"}, {"msg", "blocked a=b request"}}
+
+	leefObj, err := leefStringToObject(leefMessage3)
+
+	if err != nil {
+		t.Fatalf("failed to parse LEEF message: %v", err)
+	}
+
+	if leefObj.EventID != "Firewall Alert" {
+		t.Errorf("leefStringToObject(message3).EventID got %s; expected %s", leefObj.EventID, "Firewall Alert")
+	}
+
+	for _, v := range leefExpectedKeyValues {
+		if leefObj.Attributes[v[0]] != v[1] {
+			t.Errorf(`leefStringToObject(message3).Attributes["%s"] got %s; expected %s`, v[0], leefObj.Attributes[v[0]], v[1])
+		}
+	}
+}
+
+func TestParseLeef4(t *testing.T) {
+	if _, err := ParseLeef(leefMessage4); err == nil {
+		t.Errorf("failed to error on invalid LEEF message: %v", err)
+	}
+
+	if _, err := ParseLeef("LEEF:1.0|Vendor|Product"); err == nil {
+		t.Errorf("failed to error on truncated LEEF message: %v", err)
+	}
+
+	if _, err := ParseLeef("LEEF:2.0|Vendor|Product|1.0|Event|xZZ|a=b"); err == nil {
+		t.Errorf("failed to error on invalid LEEF delimiter: %v", err)
+	}
+}
+
+func TestParseLeef5(t *testing.T) {
+	leefObj, err := leefStringToObject(leefMessage5)
+
+	if err != nil {
+		t.Fatalf("failed to parse LEEF message: %v", err)
+	}
+
+	if leefObj.Vendor != "Vendor|Inc" {
+		t.Errorf("leefStringToObject(message5).Vendor got %s; expected %s", leefObj.Vendor, "Vendor|Inc")
+	}
+
+	// LEEF 2.0 without a delimiter field defaults to tab
+	if leefObj.Attributes["dst"] != "10.0.0.2" {
+		t.Errorf(`leefStringToObject(message5).Attributes["dst"] got %s; expected %s`, leefObj.Attributes["dst"], "10.0.0.2")
+	}
+}
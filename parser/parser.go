@@ -0,0 +1,121 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Parser converts a syslog message into a JSON object. The syslog metadata parsed by the
+// listener is supplied alongside the message content for parsers that need it.
+type Parser interface {
+	// Name returns the name the parser was registered under
+	Name() string
+
+	// Parse converts the message into a marshalled JSON object
+	Parse(message string, logParts map[string]interface{}) ([]byte, error)
+}
+
+// Config holds the settings used by factories to construct a parser
+type Config struct {
+	GrokPatterns     []string
+	GrokPatternsDir  string
+	GrokPatternFiles []string
+	GrokFieldTypes   map[string]string
+	CefExpandKeys    bool
+	CefStringValues  bool
+	KvPairSeparator  string
+	KvValueSeparator string
+	KvQuotes         string
+	KvTrim           bool
+	KvDuplicateKeys  string
+	KvRemainderField string
+	CsvDelimiter     string
+	CsvLazyQuotes    bool
+	CsvColumns       []string
+	CsvSchemaFile    string
+	RegexPatterns    []string
+	JsonPrefixField  string
+	JsonDecodeNested bool
+	XmlPrefixField   string
+	XmlWindowsEvent  bool
+}
+
+// Factory constructs a new parser from the supplied config
+type Factory func(config *Config) (Parser, error)
+
+var (
+	registryLock sync.RWMutex
+	registry     = make(map[string]Factory)
+)
+
+// Register makes a parser available under the supplied name. Registering the same
+// name twice will panic.
+func Register(name string, factory Factory) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	if factory == nil {
+		panic("parser: register factory is nil")
+	}
+
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("parser: register called twice for %s", name))
+	}
+
+	registry[name] = factory
+}
+
+// New constructs the parser registered under the supplied name
+func New(name string, config *Config) (Parser, error) {
+	registryLock.RLock()
+	factory, ok := registry[name]
+	registryLock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown parser: %s", name)
+	}
+
+	if config == nil {
+		config = &Config{}
+	}
+
+	return factory(config)
+}
+
+// Names returns the sorted names of all registered parsers
+func Names() []string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func contains(s []string, e string) bool {
+	for _, a := range s {
+		if a == e {
+			return true
+		}
+	}
+	return false
+}
+
+// funcParser adapts a parse function to the Parser interface
+type funcParser struct {
+	name  string
+	parse func(message string, logParts map[string]interface{}) ([]byte, error)
+}
+
+func (p *funcParser) Name() string {
+	return p.name
+}
+
+func (p *funcParser) Parse(message string, logParts map[string]interface{}) ([]byte, error) {
+	return p.parse(message, logParts)
+}
@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"testing"
+)
+
+func TestNames(t *testing.T) {
+	expectedNames := []string{"cef", "csv", "grok", "json", "kv", "leef", "raw", "regex", "xml"}
+
+	for _, v := range expectedNames {
+		found := false
+		for _, name := range Names() {
+			if name == v {
+				found = true
+			}
+		}
+
+		if !found {
+			t.Errorf("Names() missing %s", v)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	p, err := New("json", nil)
+
+	if err != nil {
+		t.Fatalf("failed to create json parser: %v", err)
+	}
+
+	if p.Name() != "json" {
+		t.Errorf("p.Name() got %s; expected %s", p.Name(), "json")
+	}
+
+	if _, err := p.Parse(`{"key":"value"}`, nil); err != nil {
+		t.Errorf("failed to parse JSON message: %v", err)
+	}
+
+	if _, err := New("unknown", nil); err == nil {
+		t.Errorf("failed to error on unknown parser")
+	}
+
+	if _, err := New("grok", &Config{}); err == nil {
+		t.Errorf("failed to error on grok parser without patterns")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	t.Cleanup(func() { unregister("test-upper") })
+
+	Register("test-upper", func(config *Config) (Parser, error) {
+		return &funcParser{name: "test-upper", parse: func(message string, _ map[string]interface{}) ([]byte, error) {
+			return []byte(`{"message":"` + message + `"}`), nil
+		}}, nil
+	})
+
+	p, err := New("test-upper", nil)
+
+	if err != nil {
+		t.Fatalf("failed to create registered parser: %v", err)
+	}
+
+	if result, _ := p.Parse("abc", nil); string(result) != `{"message":"abc"}` {
+		t.Errorf("p.Parse() got %s; expected %s", result, `{"message":"abc"}`)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("failed to panic on duplicate registration")
+		}
+	}()
+
+	Register("test-upper", func(config *Config) (Parser, error) { return nil, nil })
+}
+
+// unregister removes a parser registered by a test
+func unregister(name string) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	delete(registry, name)
+}
@@ -0,0 +1,16 @@
+package parser
+
+import "encoding/json"
+
+func init() {
+	Register("raw", func(config *Config) (Parser, error) {
+		return &funcParser{name: "raw", parse: func(_ string, logParts map[string]interface{}) ([]byte, error) {
+			return ParseRaw(logParts)
+		}}, nil
+	})
+}
+
+// ParseRaw will convert the syslog metadata and message to JSON without further parsing
+func ParseRaw(logParts map[string]interface{}) ([]byte, error) {
+	return json.Marshal(logParts)
+}
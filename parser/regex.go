@@ -0,0 +1,109 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dlclark/regexp2"
+)
+
+// regexMatchTimeout bounds the time spent backtracking on a single message
+const regexMatchTimeout = time.Second
+
+func init() {
+	Register("regex", func(config *Config) (Parser, error) {
+		return NewRegexParser(config.RegexPatterns)
+	})
+}
+
+// RegexParser parses messages with a list of regular expressions with named groups that are
+// compiled once when the parser is created. It is safe for concurrent use.
+type RegexParser struct {
+	patterns []*regexp2.Regexp
+	names    [][]string
+}
+
+// NewRegexParser compiles the supplied regular expressions and returns a parser that tries them in
+// order. Every expression must have at least one named group ((?<name>...) or (?P<name>...)).
+func NewRegexParser(patterns []string) (*RegexParser, error) {
+	if len(patterns) == 0 {
+		return nil, errors.New("regex parser requires at least one pattern")
+	}
+
+	p := &RegexParser{}
+
+	for _, v := range patterns {
+		re, err := regexp2.Compile(v, regexp2.RE2)
+
+		// Handle errors
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex pattern %q: %v", v, err)
+		}
+
+		re.MatchTimeout = regexMatchTimeout
+
+		// Collect named groups (unnamed groups are named by their number)
+		names := make([]string, 0)
+		for _, name := range re.GetGroupNames() {
+			if _, err := strconv.Atoi(name); err != nil {
+				names = append(names, name)
+			}
+		}
+
+		if len(names) == 0 {
+			return nil, fmt.Errorf("invalid regex pattern %q: no named groups", v)
+		}
+
+		p.patterns = append(p.patterns, re)
+		p.names = append(p.names, names)
+	}
+
+	return p, nil
+}
+
+func (p *RegexParser) Name() string {
+	return "regex"
+}
+
+func (p *RegexParser) Parse(message string, _ map[string]interface{}) ([]byte, error) {
+	result, err := p.parseEvent(message)
+
+	// Handle errors
+	if err != nil {
+		return nil, err
+	}
+
+	// Marshal JSON string
+	return json.Marshal(result)
+}
+
+// parseEvent returns the named groups of the first pattern that matches the event. Groups that did
+// not participate in the match are omitted.
+func (p *RegexParser) parseEvent(event string) (map[string]string, error) {
+	for i, re := range p.patterns {
+		match, err := re.FindStringMatch(event)
+
+		// Handle errors
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse: %v", err)
+		}
+
+		if match == nil {
+			continue
+		}
+
+		values := make(map[string]string, len(p.names[i]))
+		for _, name := range p.names[i] {
+			if group := match.GroupByName(name); group != nil && len(group.Captures) > 0 {
+				values[name] = group.String()
+			}
+		}
+
+		return values, nil
+	}
+
+	return nil, errors.New("unable to parse: no regex pattern matched")
+}
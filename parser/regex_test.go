@@ -0,0 +1,75 @@
+package parser
+
+import (
+	"sync"
+	"testing"
+)
+
+var regexMessage1 = `GET /index.html 200 512`
+var regexMessage2 = `user=bob action=login`
+
+func TestRegexParser(t *testing.T) {
+	p, err := NewRegexParser([]string{
+		`^(?<method>[A-Z]+) (?<path>\S+) (?<status>\d{3})(?: (?<bytes>\d+))?$`,
+		`^user=(?P<user>\w+)(?: action=(?<action>\w+))?$`,
+	})
+
+	if err != nil {
+		t.Fatalf("failed to create regex parser: %v", err)
+	}
+
+	regexExpectedValues := [][]string{
+		{regexMessage1, `{"bytes":"512","method":"GET","path":"/index.html","status":"200"}`},
+		{`GET /index.html 404`, `{"method":"GET","path":"/index.html","status":"404"}`},
+		{regexMessage2, `{"action":"login","user":"bob"}`},
+	}
+
+	for _, v := range regexExpectedValues {
+		result, err := p.Parse(v[0], nil)
+
+		if err != nil {
+			t.Fatalf("failed to parse regex message: %v", err)
+		}
+
+		if string(result) != v[1] {
+			t.Errorf("p.Parse(%s) got %s; expected %s", v[0], result, v[1])
+		}
+	}
+
+	if _, err := p.Parse("no match", nil); err == nil {
+		t.Errorf("failed to error on unmatched regex message")
+	}
+}
+
+func TestRegexParserInvalidPattern(t *testing.T) {
+	invalidPatterns := [][]string{nil, {`(?<name>unclosed`}, {`^\d+$`}}
+
+	for _, v := range invalidPatterns {
+		if _, err := NewRegexParser(v); err == nil {
+			t.Errorf("failed to error on invalid regex patterns %q", v)
+		}
+	}
+}
+
+func TestRegexParserConcurrent(t *testing.T) {
+	p, err := New("regex", &Config{RegexPatterns: []string{`^user=(?<user>\w+)`}})
+
+	if err != nil {
+		t.Fatalf("failed to create regex parser: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if result, err := p.Parse(regexMessage2, nil); err != nil || string(result) != `{"user":"bob"}` {
+					t.Errorf("p.Parse(message2) got %s, %v; expected %s", result, err, `{"user":"bob"}`)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseStructuredData decodes RFC 5424 structured data (e.g. `[exampleSDID@32473 iut="3"]`) into
+// an object keyed by SD-ID containing the SD-PARAMs of each element. Parameter values are unescaped
+// (\", \\ and \]) and parameters that are repeated within an element are collected into an array.
+// The nil value (-) results in an empty object.
+func ParseStructuredData(sd string) (map[string]map[string]interface{}, error) {
+	elements := make(map[string]map[string]interface{})
+
+	if sd == "" || sd == "-" {
+		return elements, nil
+	}
+
+	i := 0
+	for i < len(sd) {
+		// Start of SD-ELEMENT
+		if sd[i] != '[' {
+			return nil, fmt.Errorf("invalid structured data: expected [ at position %d", i)
+		}
+		i++
+
+		// SD-ID
+		start := i
+		for i < len(sd) && sd[i] != ' ' && sd[i] != ']' {
+			if sd[i] == '=' || sd[i] == '"' {
+				return nil, fmt.Errorf("invalid structured data: invalid character in SD-ID at position %d", i)
+			}
+			i++
+		}
+
+		id := sd[start:i]
+		if id == "" {
+			return nil, fmt.Errorf("invalid structured data: empty SD-ID at position %d", start)
+		}
+
+		params, ok := elements[id]
+		if !ok {
+			params = make(map[string]interface{})
+			elements[id] = params
+		}
+
+		// SD-PARAMs
+		for {
+			// Skip separating spaces
+			for i < len(sd) && sd[i] == ' ' {
+				i++
+			}
+
+			if i >= len(sd) {
+				return nil, fmt.Errorf("invalid structured data: unterminated element %s", id)
+			}
+
+			// End of SD-ELEMENT
+			if sd[i] == ']' {
+				i++
+				break
+			}
+
+			// PARAM-NAME
+			start = i
+			for i < len(sd) && sd[i] != '=' {
+				if sd[i] == ' ' || sd[i] == ']' || sd[i] == '"' {
+					return nil, fmt.Errorf("invalid structured data: invalid character in PARAM-NAME at position %d", i)
+				}
+				i++
+			}
+
+			name := sd[start:i]
+			if name == "" || i+1 >= len(sd) || sd[i+1] != '"' {
+				return nil, fmt.Errorf("invalid structured data: invalid SD-PARAM at position %d", start)
+			}
+			i += 2
+
+			// PARAM-VALUE with escaped ", \ and ]
+			var value strings.Builder
+			closed := false
+			for i < len(sd) {
+				c := sd[i]
+				if c == '\\' && i+1 < len(sd) && (sd[i+1] == '"' || sd[i+1] == '\\' || sd[i+1] == ']') {
+					value.WriteByte(sd[i+1])
+					i += 2
+					continue
+				}
+				if c == '"' {
+					closed = true
+					i++
+					break
+				}
+				value.WriteByte(c)
+				i++
+			}
+
+			if !closed {
+				return nil, fmt.Errorf("invalid structured data: unterminated value for %s", name)
+			}
+
+			// Collect repeated params into an array
+			switch existing := params[name].(type) {
+			case nil:
+				params[name] = value.String()
+			case string:
+				params[name] = []string{existing, value.String()}
+			case []string:
+				params[name] = append(existing, value.String())
+			}
+		}
+	}
+
+	return elements, nil
+}
@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var structuredData1 = `[exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"][examplePriority@32473 class="high"]`
+var structuredData2 = `[meta@1 msg="say \"hi\" to C:\\temp \] done" path="a\b"]`
+var structuredData3 = `[origin ip="10.0.0.1" ip="10.0.0.2" ip="10.0.0.3"][timeQuality tzKnown="1"]`
+var structuredData4 = `[exampleSDID@32473 iut="3"`
+
+func TestParseStructuredData(t *testing.T) {
+	sdObj, err := ParseStructuredData(structuredData1)
+
+	if err != nil {
+		t.Fatalf("failed to parse structured data: %v", err)
+	}
+
+	sdExpectedValues := [][]string{
+		{"exampleSDID@32473", "iut", "3"},
+		{"exampleSDID@32473", "eventSource", "Application"},
+		{"exampleSDID@32473", "eventID", "1011"},
+		{"examplePriority@32473", "class", "high"},
+	}
+
+	for _, v := range sdExpectedValues {
+		if sdObj[v[0]][v[1]] != v[2] {
+			t.Errorf(`ParseStructuredData(structuredData1)["%s"]["%s"] got %v; expected %s`, v[0], v[1], sdObj[v[0]][v[1]], v[2])
+		}
+	}
+}
+
+func TestParseStructuredData2(t *testing.T) {
+	sdObj, err := ParseStructuredData(structuredData2)
+
+	if err != nil {
+		t.Fatalf("failed to parse structured data: %v", err)
+	}
+
+	if sdObj["meta@1"]["msg"] != `say "hi" to C:\temp ] done` {
+		t.Errorf(`ParseStructuredData(structuredData2)["meta@1"]["msg"] got %v; expected %s`, sdObj["meta@1"]["msg"], `say "hi" to C:\temp ] done`)
+	}
+
+	// Backslashes that do not escape ", \ or ] are kept
+	if sdObj["meta@1"]["path"] != `a\b` {
+		t.Errorf(`ParseStructuredData(structuredData2)["meta@1"]["path"] got %v; expected %s`, sdObj["meta@1"]["path"], `a\b`)
+	}
+}
+
+func TestParseStructuredData3(t *testing.T) {
+	sdObj, err := ParseStructuredData(structuredData3)
+
+	if err != nil {
+		t.Fatalf("failed to parse structured data: %v", err)
+	}
+
+	jsonString, err := json.Marshal(sdObj)
+
+	if err != nil {
+		t.Fatalf("failed to marshal structured data: %v", err)
+	}
+
+	expectedJson := `{"origin":{"ip":["10.0.0.1","10.0.0.2","10.0.0.3"]},"timeQuality":{"tzKnown":"1"}}`
+	if string(jsonString) != expectedJson {
+		t.Errorf("json.Marshal(sdObj) got %s; expected %s", jsonString, expectedJson)
+	}
+}
+
+func TestParseStructuredData4(t *testing.T) {
+	invalidStructuredData := []string{
+		structuredData4,
+		`exampleSDID@32473 iut="3"]`,
+		`[exampleSDID@32473 iut=3]`,
+		`[exampleSDID@32473 iut="3]`,
+		`[ iut="3"]`,
+		`[exampleSDID@32473 iut="3"] trailing`,
+	}
+
+	for _, v := range invalidStructuredData {
+		if _, err := ParseStructuredData(v); err == nil {
+			t.Errorf("failed to error on invalid structured data: %s", v)
+		}
+	}
+
+	if sdObj, err := ParseStructuredData("-"); err != nil || len(sdObj) != 0 {
+		t.Errorf("ParseStructuredData(-) got %v, %v; expected empty object", sdObj, err)
+	}
+}
@@ -0,0 +1,233 @@
+package parser
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+func init() {
+	Register("xml", func(config *Config) (Parser, error) {
+		prefixField := config.XmlPrefixField
+		if prefixField == "" {
+			prefixField = "prefix"
+		}
+
+		return &XmlParser{prefixField: prefixField, windowsEvent: config.XmlWindowsEvent}, nil
+	})
+}
+
+// xmlNode is an element of a parsed XML document
+type xmlNode struct {
+	name     string
+	attrs    []xml.Attr
+	children []*xmlNode
+	text     strings.Builder
+}
+
+// XmlParser converts XML documents to JSON. Attributes are prefixed with @, text alongside attributes
+// or child elements is kept in #text and repeated elements are collected into arrays.
+type XmlParser struct {
+	prefixField  string
+	windowsEvent bool
+}
+
+func (p *XmlParser) Name() string {
+	return "xml"
+}
+
+func (p *XmlParser) Parse(message string, _ map[string]interface{}) ([]byte, error) {
+	result, err := p.parseEvent(message)
+
+	// Handle errors
+	if err != nil {
+		return nil, err
+	}
+
+	// Marshal JSON string
+	return json.Marshal(result)
+}
+
+// parseEvent converts the XML document in the event to a map keyed by the root element name. Text
+// before the document (such as a program tag) is kept in the prefix field, unless the root element
+// has the same name.
+func (p *XmlParser) parseEvent(event string) (map[string]interface{}, error) {
+	i := xmlStartIndex(event)
+
+	if i < 0 {
+		return nil, errors.New("string is not in xml format")
+	}
+
+	root, err := parseXmlDocument(event[i:])
+
+	if err != nil {
+		return nil, err
+	}
+
+	value := root.value()
+
+	// Flatten the Windows event data pairs
+	if p.windowsEvent && root.name == "Event" {
+		if eventMap, ok := value.(map[string]interface{}); ok {
+			if eventData, ok := eventMap["EventData"].(map[string]interface{}); ok {
+				eventMap["EventData"] = flattenXmlEventData(eventData)
+			}
+		}
+	}
+
+	result := map[string]interface{}{root.name: value}
+
+	if prefix := strings.TrimSpace(event[:i]); prefix != "" {
+		if _, exists := result[p.prefixField]; !exists {
+			result[p.prefixField] = prefix
+		}
+	}
+
+	return result, nil
+}
+
+// xmlStartIndex returns the index of the first < that starts an XML declaration or element, or -1.
+// Other < characters, such as a syslog <PRI> marker, are skipped.
+func xmlStartIndex(event string) int {
+	for i := 0; i < len(event); i++ {
+		if event[i] != '<' {
+			continue
+		}
+
+		if strings.HasPrefix(event[i:], "<?xml") {
+			return i
+		}
+
+		if r, _ := utf8.DecodeRuneInString(event[i+1:]); r == '_' || r == ':' || unicode.IsLetter(r) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// parseXmlDocument reads the root element of the document into a tree
+func parseXmlDocument(document string) (*xmlNode, error) {
+	decoder := xml.NewDecoder(strings.NewReader(document))
+	stack := make([]*xmlNode, 0)
+
+	for {
+		token, err := decoder.Token()
+
+		// Handle errors
+		if err == io.EOF {
+			return nil, errors.New("invalid xml format: unexpected end of document")
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid xml format: %v", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name.Local, attrs: t.Attr}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			node := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			// Ignore anything after the root element
+			if len(stack) == 0 {
+				return node, nil
+			}
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		}
+	}
+}
+
+// value converts the element to a string when it only holds text, otherwise to a map
+func (n *xmlNode) value() interface{} {
+	text := strings.TrimSpace(n.text.String())
+	values := make(map[string]interface{})
+
+	for _, attr := range n.attrs {
+		// Skip namespace declarations
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		values["@"+attr.Name.Local] = attr.Value
+	}
+
+	if len(values) == 0 && len(n.children) == 0 {
+		return text
+	}
+
+	for _, child := range n.children {
+		value := child.value()
+
+		switch existing := values[child.name].(type) {
+		case nil:
+			values[child.name] = value
+		case []interface{}:
+			values[child.name] = append(existing, value)
+		default:
+			values[child.name] = []interface{}{existing, value}
+		}
+	}
+
+	if text != "" {
+		values["#text"] = text
+	}
+
+	return values
+}
+
+// flattenXmlEventData converts the <Data Name="key">value</Data> elements of a Windows event into
+// key value pairs. Data elements without a name are kept in the Data field.
+func flattenXmlEventData(eventData map[string]interface{}) map[string]interface{} {
+	flattened := make(map[string]interface{}, len(eventData))
+	unnamed := make([]interface{}, 0)
+
+	data, ok := eventData["Data"].([]interface{})
+	if !ok {
+		data = []interface{}{eventData["Data"]}
+	}
+
+	for _, item := range data {
+		element, ok := item.(map[string]interface{})
+		if !ok {
+			if item != nil {
+				unnamed = append(unnamed, item)
+			}
+			continue
+		}
+
+		name, ok := element["@Name"].(string)
+		if !ok {
+			unnamed = append(unnamed, item)
+			continue
+		}
+
+		value, _ := element["#text"].(string)
+		flattened[name] = value
+	}
+
+	for k, v := range eventData {
+		if k != "Data" {
+			flattened[k] = v
+		}
+	}
+
+	if len(unnamed) == 1 {
+		flattened["Data"] = unnamed[0]
+	} else if len(unnamed) > 1 {
+		flattened["Data"] = unnamed
+	}
+
+	return flattened
+}
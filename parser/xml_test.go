@@ -0,0 +1,95 @@
+package parser
+
+import (
+	"testing"
+)
+
+var xmlMessage1 = `<Event xmlns="http://schemas.microsoft.com/win/2004/08/events/event"><System><Provider Name="Microsoft-Windows-Security-Auditing" Guid="{54849625-5478-4994-A5BA-3E3B0328C30D}"/><EventID>4624</EventID><Computer>dc01.example.local</Computer></System><EventData><Data Name="SubjectUserSid">S-1-5-18</Data><Data Name="TargetUserName">bob</Data><Data Name="IpAddress">-</Data><Data Name="Empty"/></EventData></Event>`
+var xmlMessage2 = `MSWinEventLog: <Event><EventData><Data>first</Data><Data>second</Data><Binary>00</Binary></EventData></Event>`
+var xmlMessage3 = `<catalog><book id="1">Go &amp; XML</book><book id="2"><title>Second</title></book><empty/></catalog>`
+
+func TestXmlParser(t *testing.T) {
+	p, err := New("xml", nil)
+
+	if err != nil {
+		t.Fatalf("failed to create xml parser: %v", err)
+	}
+
+	xmlExpectedValues := [][]string{
+		{xmlMessage3, `{"catalog":{"book":[{"#text":"Go \u0026 XML","@id":"1"},{"@id":"2","title":"Second"}],"empty":""}}`},
+		{xmlMessage1, `{"Event":{"EventData":{"Data":[{"#text":"S-1-5-18","@Name":"SubjectUserSid"},{"#text":"bob","@Name":"TargetUserName"},{"#text":"-","@Name":"IpAddress"},{"@Name":"Empty"}]},"System":{"Computer":"dc01.example.local","EventID":"4624","Provider":{"@Guid":"{54849625-5478-4994-A5BA-3E3B0328C30D}","@Name":"Microsoft-Windows-Security-Auditing"}}}}`},
+	}
+
+	for _, v := range xmlExpectedValues {
+		result, err := p.Parse(v[0], nil)
+
+		if err != nil {
+			t.Fatalf("failed to parse XML message: %v", err)
+		}
+
+		if string(result) != v[1] {
+			t.Errorf("p.Parse(%s) got %s; expected %s", v[0], result, v[1])
+		}
+	}
+
+	invalidMessages := []string{"not xml", `<Event><System></Event>`, `<Event>`, `<134>Oct 1 host: no xml`}
+
+	for _, v := range invalidMessages {
+		if _, err := p.Parse(v, nil); err == nil {
+			t.Errorf("failed to error on invalid XML message: %s", v)
+		}
+	}
+}
+
+func TestXmlParserWindowsEvent(t *testing.T) {
+	p, err := New("xml", &Config{XmlWindowsEvent: true})
+
+	if err != nil {
+		t.Fatalf("failed to create xml parser: %v", err)
+	}
+
+	xmlExpectedValues := [][]string{
+		{xmlMessage1, `{"Event":{"EventData":{"Empty":"","IpAddress":"-","SubjectUserSid":"S-1-5-18","TargetUserName":"bob"},"System":{"Computer":"dc01.example.local","EventID":"4624","Provider":{"@Guid":"{54849625-5478-4994-A5BA-3E3B0328C30D}","@Name":"Microsoft-Windows-Security-Auditing"}}}}`},
+		{xmlMessage2, `{"Event":{"EventData":{"Binary":"00","Data":["first","second"]}},"prefix":"MSWinEventLog:"}`},
+	}
+
+	for _, v := range xmlExpectedValues {
+		result, err := p.Parse(v[0], nil)
+
+		if err != nil {
+			t.Fatalf("failed to parse XML message: %v", err)
+		}
+
+		if string(result) != v[1] {
+			t.Errorf("p.Parse(%s) got %s; expected %s", v[0], result, v[1])
+		}
+	}
+}
+
+func TestXmlParserPrefixField(t *testing.T) {
+	p, err := New("xml", &Config{XmlPrefixField: "program"})
+
+	if err != nil {
+		t.Fatalf("failed to create xml parser: %v", err)
+	}
+
+	xmlExpectedValues := [][]string{
+		{`myapp: <a>1</a>`, `{"a":"1","program":"myapp:"}`},
+		{`myapp: <program>1</program>`, `{"program":"1"}`},
+		{`<134>Oct 1 host: <Event><EventID>4624</EventID></Event>`, `{"Event":{"EventID":"4624"},"program":"\u003c134\u003eOct 1 host:"}`},
+		{`<134>Oct 1 host: <?xml version="1.0"?><a>1</a>`, `{"a":"1","program":"\u003c134\u003eOct 1 host:"}`},
+		{`a < b: <_x>1</_x>`, `{"_x":"1","program":"a \u003c b:"}`},
+	}
+
+	for _, v := range xmlExpectedValues {
+		result, err := p.Parse(v[0], nil)
+
+		if err != nil {
+			t.Fatalf("failed to parse XML message: %v", err)
+		}
+
+		if string(result) != v[1] {
+			t.Errorf("p.Parse(%s) got %s; expected %s", v[0], result, v[1])
+		}
+	}
+}
@@ -0,0 +1,63 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerCredentialsSize is the size of the control message holding the credentials of a datagram
+var peerCredentialsSize = syscall.CmsgSpace(syscall.SizeofUcred)
+
+// enablePeerCredentials asks the kernel to attach the credentials of the sender to each datagram
+func enablePeerCredentials(conn *net.UnixConn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_PASSCRED, 1)
+	}); err != nil {
+		return err
+	}
+
+	return sockErr
+}
+
+// streamPeerCredentials returns the credentials of the process that opened the connection
+func streamPeerCredentials(conn *net.UnixConn) *peerCredentials {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil
+	}
+
+	var ucred *syscall.Ucred
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		ucred, sockErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil || sockErr != nil {
+		return nil
+	}
+
+	return &peerCredentials{pid: int(ucred.Pid), uid: int(ucred.Uid), gid: int(ucred.Gid)}
+}
+
+// datagramPeerCredentials returns the credentials of the sender from the control message of a datagram
+func datagramPeerCredentials(oob []byte) *peerCredentials {
+	messages, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil
+	}
+
+	for i := range messages {
+		if ucred, err := syscall.ParseUnixCredentials(&messages[i]); err == nil {
+			return &peerCredentials{pid: int(ucred.Pid), uid: int(ucred.Uid), gid: int(ucred.Gid)}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"net"
+)
+
+// peerCredentialsSize is zero as peer credentials are only captured on Linux
+const peerCredentialsSize = 0
+
+// enablePeerCredentials is a no-op as peer credentials are only captured on Linux
+func enablePeerCredentials(_ *net.UnixConn) error {
+	return nil
+}
+
+// streamPeerCredentials is not supported on this platform
+func streamPeerCredentials(_ *net.UnixConn) *peerCredentials {
+	return nil
+}
+
+// datagramPeerCredentials is not supported on this platform
+func datagramPeerCredentials(_ []byte) *peerCredentials {
+	return nil
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/mcuadros/go-syslog.v2"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// relpSoftware identifies the collector in the response to the RELP open command
+const relpSoftware = "syslog-collector"
+
+// relpAckField is the log part that hands the acknowledgement channel of a RELP event to the event
+// loop. It is removed from the event before it is processed.
+const relpAckField = "relp_ack"
+
+// relpMaxDigits is the maximum number of digits of a RELP transaction number or data length
+const relpMaxDigits = 9
+
+// relpMaxCommand is the maximum length of a RELP command
+const relpMaxCommand = 32
+
+// relpWindow is the number of transactions of a session that can wait for their response
+const relpWindow = 128
+
+// relpWriteTimeout bounds the time to send a response to a RELP client
+const relpWriteTimeout = 30 * time.Second
+
+// relpFrame is a RELP (Reliable Event Logging Protocol) frame: TXNR SP COMMAND SP DATALEN [SP DATA] LF
+type relpFrame struct {
+	txnr    int
+	command string
+	data    []byte
+}
+
+// relpServer accepts RELP sessions and only acknowledges a syslog message once the event loop has
+// written it to the tmp log and synced it to disk, so unacknowledged messages are resent by the
+// client after a restart
+type relpServer struct {
+	*streamServer
+	handler *listenerHandler
+}
+
+// startRelpServer listens for RELP sessions on the address and hands the messages to the handler
+func startRelpServer(address string, handler *listenerHandler) (*relpServer, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &relpServer{handler: handler}
+	s.streamServer = startStreamServer(listener, s.serve)
+
+	return s, nil
+}
+
+// relpResponse is a response to a transaction. Responses are sent in the order of the transactions,
+// and those with an ack channel are sent once the event loop has acknowledged the message.
+type relpResponse struct {
+	txnr    int
+	command string
+	data    string
+	ack     chan error
+}
+
+// serve runs the RELP session of the connection. Up to relpWindow transactions are read ahead while
+// earlier messages wait to be acknowledged.
+func (s *relpServer) serve(conn net.Conn) {
+	client := conn.RemoteAddr().String()
+	reader := bufio.NewReader(conn)
+	open := false
+
+	// Send responses as their messages are acknowledged
+	responses := make(chan *relpResponse, relpWindow)
+	done := make(chan bool)
+	go s.respond(conn, client, responses, done)
+
+	defer func() {
+		close(responses)
+		<-done
+	}()
+
+	for {
+		frame, err := readRelpFrame(reader)
+
+		// Handle errors
+		if err != nil {
+			if s.isClosing() {
+				responses <- &relpResponse{command: "serverclose"}
+			} else if err != io.EOF && !isClosedConnError(err) {
+				log.Warnf("closing RELP session from %s: %v", client, err)
+			}
+			return
+		}
+
+		response := &relpResponse{txnr: frame.txnr, command: "rsp"}
+		closeSession := false
+
+		switch frame.command {
+		case "open":
+			offers, err := relpOpenResponse(frame.data)
+			if err != nil {
+				response.data, closeSession = fmt.Sprintf("500 %v", err), true
+			} else {
+				response.data, open = "200 OK\n"+offers, true
+			}
+		case "syslog":
+			if !open {
+				response.data, closeSession = "500 session not open", true
+			} else {
+				response.ack = s.handleMessage(frame.data, client)
+			}
+		case "close":
+			closeSession = true
+		default:
+			response.data = fmt.Sprintf("500 unknown command %s", frame.command)
+		}
+
+		responses <- response
+
+		if closeSession {
+			return
+		}
+	}
+}
+
+// respond sends the responses of the session in order. Once a response cannot be sent the
+// connection is closed, which stops the session.
+func (s *relpServer) respond(conn net.Conn, client string, responses chan *relpResponse, done chan bool) {
+	defer close(done)
+	failed := false
+
+	for response := range responses {
+		if response.ack != nil {
+			if err := <-response.ack; err != nil {
+				log.Errorf("unable to acknowledge RELP message from %s: %v", client, err)
+				response.data = "500 unable to write event"
+			} else {
+				response.data = "200 OK"
+			}
+		}
+
+		// Keep waiting for acknowledgements so the event loop is never blocked
+		if failed {
+			continue
+		}
+
+		if err := writeRelpFrame(conn, response.txnr, response.command, response.data); err != nil {
+			log.Warnf("closing RELP session from %s: %v", client, err)
+			failed = true
+			conn.Close()
+		}
+	}
+}
+
+// handleMessage hands the syslog message to the event loop. Returns the channel the event loop
+// acknowledges the message on once it is written.
+func (s *relpServer) handleMessage(message []byte, client string) chan error {
+	parser := syslog.Automatic.GetParser(message)
+	err := parser.Parse()
+
+	logParts := parser.Dump()
+	logParts["client"] = client
+	logParts["tls_peer"] = ""
+
+	ack := make(chan error, 1)
+	logParts[relpAckField] = ack
+
+	s.handler.Handle(logParts, int64(len(message)), err)
+
+	return ack
+}
+
+// relpAck is the acknowledgement of a RELP message handled by the event loop
+type relpAck struct {
+	ack     chan error
+	sink    *sink
+	written bool
+	err     error
+}
+
+// relpAcks collects the acknowledgements of RELP messages so the tmp logs are synced once for all
+// of them
+type relpAcks struct {
+	acks []relpAck
+}
+
+// add records the acknowledgement of a message. Messages that were not written to the tmp log of
+// the sink were dead-lettered or skipped.
+func (a *relpAcks) add(ack chan error, s *sink, written bool, err error) {
+	a.acks = append(a.acks, relpAck{ack: ack, sink: s, written: written, err: err})
+}
+
+// flush syncs the tmp logs and dead-letters the messages were written to and acknowledges them
+func (a *relpAcks) flush(deadLetters *deadLetterWriter) {
+	if len(a.acks) == 0 {
+		return
+	}
+
+	synced := make(map[*sink]error)
+	var deadLetterErr error
+	deadLettersSynced := false
+
+	for _, ack := range a.acks {
+		err := ack.err
+
+		if err == nil && ack.written {
+			if _, ok := synced[ack.sink]; !ok {
+				synced[ack.sink] = ack.sink.tmpWriter.Fp.Sync()
+			}
+			err = synced[ack.sink]
+		} else if err == nil {
+			if !deadLettersSynced {
+				deadLetterErr, deadLettersSynced = deadLetters.Sync(), true
+			}
+			err = deadLetterErr
+		}
+
+		ack.ack <- err
+	}
+
+	a.acks = a.acks[:0]
+}
+
+// takeRelpAck removes the acknowledgement channel from a RELP event, returning nil for other events
+func takeRelpAck(logParts map[string]interface{}) chan error {
+	ack, ok := logParts[relpAckField].(chan error)
+	if !ok {
+		return nil
+	}
+
+	delete(logParts, relpAckField)
+	return ack
+}
+
+// relpOpenResponse returns the offers of the response to the open command. The client must offer
+// the syslog command.
+func relpOpenResponse(data []byte) (string, error) {
+	commands := ""
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.IndexByte(line, '='); i > 0 && line[:i] == "commands" {
+			commands = line[i+1:]
+		}
+	}
+
+	if !contains(strings.Split(commands, ","), "syslog") {
+		return "", errors.New("client does not offer the syslog command")
+	}
+
+	return fmt.Sprintf("relp_version=0\nrelp_software=%s\ncommands=syslog", relpSoftware), nil
+}
+
+// readRelpFrame reads the next frame of the session
+func readRelpFrame(reader *bufio.Reader) (*relpFrame, error) {
+	// Read transaction number
+	txnr, _, err := readRelpField(reader, relpMaxDigits)
+	if err != nil {
+		return nil, err
+	}
+
+	number, err := strconv.Atoi(txnr)
+	if err != nil || number < 0 {
+		return nil, fmt.Errorf("invalid RELP transaction number %q", txnr)
+	}
+
+	// Read command
+	command, _, err := readRelpField(reader, relpMaxCommand)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	// Read data length (the data is left out with its separator when empty)
+	dataLength, separator, err := readRelpField(reader, relpMaxDigits)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	length, err := strconv.Atoi(dataLength)
+	if err != nil || length < 0 || length > maxFrameSize {
+		return nil, fmt.Errorf("invalid RELP data length %q", dataLength)
+	}
+
+	frame := &relpFrame{txnr: number, command: command, data: make([]byte, length)}
+	if separator == '\n' {
+		if length > 0 {
+			return nil, errors.New("invalid RELP frame: missing data")
+		}
+		return frame, nil
+	}
+
+	// Read data and trailer
+	if _, err := io.ReadFull(reader, frame.data); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	trailer, err := reader.ReadByte()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	if trailer != '\n' {
+		return nil, errors.New("invalid RELP frame: missing trailer")
+	}
+
+	return frame, nil
+}
+
+// readRelpField reads a header field terminated by a space or newline. Returns the field and the
+// terminator.
+func readRelpField(reader *bufio.Reader, maxLength int) (string, byte, error) {
+	var field strings.Builder
+
+	for {
+		c, err := reader.ReadByte()
+		if err != nil {
+			if field.Len() > 0 {
+				return "", 0, unexpectedEOF(err)
+			}
+			return "", 0, err
+		}
+
+		if c == ' ' || c == '\n' {
+			if field.Len() == 0 {
+				return "", 0, errors.New("invalid RELP frame: empty header field")
+			}
+			return field.String(), c, nil
+		}
+
+		if field.Len() == maxLength {
+			return "", 0, errors.New("invalid RELP frame: header field too long")
+		}
+		field.WriteByte(c)
+	}
+}
+
+// writeRelpFrame sends a frame to the client
+func writeRelpFrame(conn net.Conn, txnr int, command string, data string) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(relpWriteTimeout)); err != nil {
+		return err
+	}
+
+	frame := fmt.Sprintf("%d %s %d\n", txnr, command, len(data))
+	if data != "" {
+		frame = fmt.Sprintf("%d %s %d %s\n", txnr, command, len(data), data)
+	}
+
+	_, err := io.WriteString(conn, frame)
+	return err
+}
+
+// isClosedConnError returns whether the error is from reading a connection closed by the session
+func isClosedConnError(err error) bool {
+	return strings.Contains(err.Error(), "use of closed network connection")
+}
+
+// unexpectedEOF reports the end of the stream in the middle of a frame as an error
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"gopkg.in/mcuadros/go-syslog.v2"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestReadRelpFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		stream  string
+		txnr    int
+		command string
+		data    string
+	}{
+		{"open", "1 open 15 commands=syslog\n", 1, "open", "commands=syslog"},
+		{"syslog", "2 syslog 11 <13>message\n", 2, "syslog", "<13>message"},
+		{"multi-line data", "3 syslog 13 <13>line\nline\n", 3, "syslog", "<13>line\nline"},
+		{"data with trailer byte", "4 syslog 2 \n\n\n", 4, "syslog", "\n\n"},
+		{"without data", "5 close 0\n", 5, "close", ""},
+		{"without data with separator", "6 close 0 \n", 6, "close", ""},
+	}
+
+	for _, test := range tests {
+		frame, err := readRelpFrame(bufio.NewReader(strings.NewReader(test.stream)))
+
+		if err != nil {
+			t.Errorf("%s: failed to read RELP frame: %v", test.name, err)
+			continue
+		}
+
+		if frame.txnr != test.txnr || frame.command != test.command || string(frame.data) != test.data {
+			t.Errorf("%s: got %d %s %q; expected %d %s %q", test.name, frame.txnr, frame.command, frame.data, test.txnr, test.command, test.data)
+		}
+	}
+}
+
+func TestReadRelpFrames(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("1 open 15 commands=syslog\n2 syslog 5 hello\n3 close 0\n"))
+
+	for _, command := range []string{"open", "syslog", "close"} {
+		frame, err := readRelpFrame(reader)
+
+		if err != nil {
+			t.Fatalf("failed to read RELP frame: %v", err)
+		}
+
+		if frame.command != command {
+			t.Errorf("frame.command got %s; expected %s", frame.command, command)
+		}
+	}
+
+	if _, err := readRelpFrame(reader); err != io.EOF {
+		t.Errorf("readRelpFrame at end of stream got %v; expected EOF", err)
+	}
+}
+
+func TestReadRelpFrameInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+	}{
+		{"non-numeric transaction number", "a syslog 5 hello\n"},
+		{"long transaction number", "1234567890 syslog 5 hello\n"},
+		{"long command", fmt.Sprintf("1 %s 5 hello\n", strings.Repeat("a", 33))},
+		{"empty header field", "1  syslog 5 hello\n"},
+		{"non-numeric length", "1 syslog a hello\n"},
+		{"negative length", "1 syslog -5 hello\n"},
+		{"oversized length", fmt.Sprintf("1 syslog %d hello\n", maxFrameSize+1)},
+		{"long length", "1 syslog 1234567890 hello\n"},
+		{"missing data", "1 syslog 5\n"},
+		{"missing trailer", "1 syslog 5 hello!\n"},
+		{"truncated data", "1 syslog 10 hello"},
+		{"truncated header", "1 syslog"},
+	}
+
+	for _, test := range tests {
+		if frame, err := readRelpFrame(bufio.NewReader(strings.NewReader(test.stream))); err == nil {
+			t.Errorf("%s: failed to error on invalid RELP frame, got %+v", test.name, frame)
+		} else if err == io.EOF {
+			t.Errorf("%s: got EOF; expected an error for the incomplete frame", test.name)
+		}
+	}
+}
+
+func TestRelpOpenResponse(t *testing.T) {
+	offers, err := relpOpenResponse([]byte("relp_version=0\nrelp_software=librelp,1.2.16\ncommands=syslog"))
+
+	if err != nil {
+		t.Fatalf("failed to build RELP open response: %v", err)
+	}
+
+	expected := "relp_version=0\nrelp_software=syslog-collector\ncommands=syslog"
+	if offers != expected {
+		t.Errorf("relpOpenResponse got %q; expected %q", offers, expected)
+	}
+
+	if _, err := relpOpenResponse([]byte("relp_version=0\ncommands=other,syslog")); err != nil {
+		t.Errorf("relpOpenResponse failed with several commands: %v", err)
+	}
+
+	invalidOffers := []string{"", "relp_version=0", "commands=other", "commands=syslogx"}
+
+	for _, offer := range invalidOffers {
+		if _, err := relpOpenResponse([]byte(offer)); err == nil {
+			t.Errorf("relpOpenResponse(%q) failed to error without the syslog command", offer)
+		}
+	}
+}
+
+func TestRelpSession(t *testing.T) {
+	client, conn := net.Pipe()
+	channel := make(syslog.LogPartsChannel)
+	s := &relpServer{streamServer: &streamServer{}, handler: &listenerHandler{channel: channel}}
+
+	done := make(chan bool)
+	go func() {
+		s.serve(conn)
+		conn.Close()
+		close(done)
+	}()
+
+	// Acknowledge the messages in reverse order, failing the second
+	go func() {
+		acks := make([]chan error, 0)
+		for i := 0; i < 3; i++ {
+			logParts := <-channel
+			acks = append(acks, takeRelpAck(logParts))
+		}
+
+		for i := len(acks) - 1; i >= 0; i-- {
+			if i == 1 {
+				acks[i] <- errors.New("write failed")
+			} else {
+				acks[i] <- nil
+			}
+		}
+	}()
+
+	go func() {
+		_, _ = io.WriteString(client, "1 syslog 5 hello\n")
+	}()
+
+	reader := bufio.NewReader(client)
+	if response, _ := reader.ReadString('\n'); response != "1 rsp 20 500 session not open\n" {
+		t.Fatalf("syslog before open got %q", response)
+	}
+	<-done
+
+	// Pipeline a full session
+	client, conn = net.Pipe()
+	done = make(chan bool)
+	go func() {
+		s.serve(conn)
+		conn.Close()
+		close(done)
+	}()
+
+	go func() {
+		_, _ = io.WriteString(client, "1 open 15 commands=syslog\n2 syslog 5 <13>a\n3 syslog 5 <13>b\n4 syslog 5 <13>c\n5 bogus 0\n6 close 0\n")
+	}()
+
+	expected := []string{
+		"1 rsp 68 200 OK\n",
+		"relp_version=0\n",
+		"relp_software=syslog-collector\n",
+		"commands=syslog\n",
+		"2 rsp 6 200 OK\n",
+		"3 rsp 25 500 unable to write event\n",
+		"4 rsp 6 200 OK\n",
+		"5 rsp 25 500 unknown command bogus\n",
+		"6 rsp 0\n",
+	}
+
+	reader = bufio.NewReader(client)
+	for _, line := range expected {
+		if response, err := reader.ReadString('\n'); err != nil || response != line {
+			t.Errorf("RELP response got %q, %v; expected %q", response, err, line)
+		}
+	}
+
+	<-done
+}
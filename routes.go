@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"github.com/rfizzle/syslog-collector/parser"
+	"github.com/spf13/viper"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// defaultRoute is the name of the route used when no routing rule matches
+const defaultRoute = "default"
+
+// routeRule is a routing rule as supplied in the routes param
+type routeRule struct {
+	Name    string
+	Match   map[string]string
+	Content string
+	Parser  string
+	Options map[string]interface{}
+}
+
+// route selects a parser chain for the messages that match all of its conditions
+type route struct {
+	name     string
+	fields   map[string]*regexp.Regexp
+	networks []*net.IPNet
+	content  *regexp.Regexp
+	chain    *parser.Chain
+}
+
+// router selects the parser chain for each message from the routing rules, falling back to the
+// parser settings of the listener and then the global parser params
+type router struct {
+	routes         []*route
+	listenerChains map[string]*parser.Chain
+	defaultChain   *parser.Chain
+}
+
+// newRouter builds the default parser chain from the parser params and a parser chain for each
+// listener with its own parser settings and each routing rule in the routes param
+func newRouter() (*router, error) {
+	config, err := parserConfig(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultChain, err := parser.NewChain(parserNames(), config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parser configuration: %v", err)
+	}
+
+	r := &router{defaultChain: defaultChain, listenerChains: make(map[string]*parser.Chain)}
+
+	// Build the parser chains of listeners with their own parser settings
+	listeners, err := listenerConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, l := range listeners {
+		if l.Parser == "" && len(l.Options) == 0 {
+			continue
+		}
+
+		chain, err := newParserChain(l.Parser, l.Options)
+		if err != nil {
+			return nil, fmt.Errorf("invalid listener %s: %v", l.Name, err)
+		}
+		r.listenerChains[l.Name] = chain
+	}
+
+	// Get routing rules
+	rules := make([]routeRule, 0)
+	if err := viper.UnmarshalKey("routes", &rules); err != nil {
+		return nil, fmt.Errorf("invalid routes param: %v", err)
+	}
+
+	names := make([]string, 0, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("route-%d", i+1)
+		}
+
+		if contains(names, rule.Name) || rule.Name == defaultRoute {
+			return nil, fmt.Errorf("invalid routes param: duplicate route name %s", rule.Name)
+		}
+		names = append(names, rule.Name)
+
+		rt, err := newRoute(rule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route %s: %v", rule.Name, err)
+		}
+
+		r.routes = append(r.routes, rt)
+	}
+
+	return r, nil
+}
+
+// newRoute compiles the conditions of the routing rule and builds its parser chain
+func newRoute(rule routeRule) (*route, error) {
+	rt := &route{name: rule.Name, fields: make(map[string]*regexp.Regexp)}
+
+	// Compile field conditions (client also accepts an IP address or CIDR range)
+	for field, pattern := range rule.Match {
+		if field == "client" {
+			if network := parseNetwork(pattern); network != nil {
+				rt.networks = append(rt.networks, network)
+				continue
+			}
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid match pattern for %s: %v", field, err)
+		}
+		rt.fields[field] = re
+	}
+
+	// Compile content condition
+	if rule.Content != "" {
+		re, err := regexp.Compile(rule.Content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid content pattern: %v", err)
+		}
+		rt.content = re
+	}
+
+	chain, err := newParserChain(rule.Parser, rule.Options)
+	if err != nil {
+		return nil, err
+	}
+	rt.chain = chain
+
+	return rt, nil
+}
+
+// newParserChain builds a parser chain from a comma separated parser chain and parser options,
+// falling back to the global parser params for anything not supplied
+func newParserChain(parsers string, parserOptions map[string]interface{}) (*parser.Chain, error) {
+	// Validate parser options
+	options := viper.New()
+	for key, value := range parserOptions {
+		if !contains(parserParams, key) {
+			return nil, fmt.Errorf("unknown parser option %s", key)
+		}
+		options.Set(key, value)
+	}
+
+	// Default to the global parser chain
+	names := parserNames()
+	if parsers != "" {
+		names = splitParserNames(parsers)
+	}
+
+	config, err := parserConfig(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return parser.NewChain(names, config)
+}
+
+// route returns the name and parser chain of the first route that matches the message. Messages
+// that match no route use the parser chain of their listener, if it has one, or the global chain.
+func (r *router) route(logParts map[string]interface{}, message string) (string, *parser.Chain) {
+	for _, rt := range r.routes {
+		if rt.matches(logParts, message) {
+			return rt.name, rt.chain
+		}
+	}
+
+	if name, ok := logParts["listener"].(string); ok {
+		if chain, ok := r.listenerChains[name]; ok {
+			return defaultRoute, chain
+		}
+	}
+
+	return defaultRoute, r.defaultChain
+}
+
+// hasRoutes returns whether any routing rules are configured
+func (r *router) hasRoutes() bool {
+	return len(r.routes) > 0
+}
+
+// matches returns whether the message meets all the conditions of the route
+func (rt *route) matches(logParts map[string]interface{}, message string) bool {
+	for field, re := range rt.fields {
+		value, ok := logParts[field]
+		if !ok || value == nil || !re.MatchString(fmt.Sprint(value)) {
+			return false
+		}
+	}
+
+	if len(rt.networks) > 0 && !matchesNetwork(rt.networks, logParts["client"]) {
+		return false
+	}
+
+	if rt.content != nil && !rt.content.MatchString(message) {
+		return false
+	}
+
+	return true
+}
+
+// parseNetwork parses an IP address or CIDR range, returning nil if it is neither
+func parseNetwork(value string) *net.IPNet {
+	if _, network, err := net.ParseCIDR(value); err == nil {
+		return network
+	}
+
+	if ip := net.ParseIP(value); ip != nil {
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 8 * net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	}
+
+	return nil
+}
+
+// matchesNetwork returns whether the client address (ip:port) is in any of the networks
+func matchesNetwork(networks []*net.IPNet, client interface{}) bool {
+	address, _ := client.(string)
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitParserNames splits a comma separated parser chain
+func splitParserNames(value string) []string {
+	names := make([]string, 0)
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
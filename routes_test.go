@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"testing"
+)
+
+func TestParserConfigOptions(t *testing.T) {
+	options := viper.New()
+	options.Set("grok-pattern", "%{IP:client} %{WORD:verb}")
+	options.Set("regex-pattern", []interface{}{`^(?P<a>\w+) (?P<b>\w+)$`, `^(?P<c>.*)$`})
+	options.Set("csv-columns", "a, ,c")
+
+	config, err := parserConfig(options)
+
+	if err != nil {
+		t.Fatalf("failed to build parser config: %v", err)
+	}
+
+	if fmt.Sprintf("%q", config.GrokPatterns) != `["%{IP:client} %{WORD:verb}"]` {
+		t.Errorf("config.GrokPatterns got %q; expected a single pattern", config.GrokPatterns)
+	}
+
+	if len(config.RegexPatterns) != 2 || config.RegexPatterns[0] != `^(?P<a>\w+) (?P<b>\w+)$` {
+		t.Errorf("config.RegexPatterns got %q; expected two patterns", config.RegexPatterns)
+	}
+
+	if fmt.Sprintf("%q", config.CsvColumns) != `["a" "" "c"]` {
+		t.Errorf("config.CsvColumns got %q; expected three columns", config.CsvColumns)
+	}
+}
+
+func TestRouteMatches(t *testing.T) {
+	rt, err := newRoute(routeRule{
+		Name:    "test",
+		Match:   map[string]string{"facility": "^3$", "client": "10.0.0.0/8"},
+		Content: "error",
+		Parser:  "raw",
+	})
+
+	if err != nil {
+		t.Fatalf("failed to create route: %v", err)
+	}
+
+	tests := []struct {
+		logParts map[string]interface{}
+		message  string
+		expected bool
+	}{
+		{map[string]interface{}{"facility": 3, "client": "10.1.2.3:514"}, "an error", true},
+		{map[string]interface{}{"facility": 13, "client": "10.1.2.3:514"}, "an error", false},
+		{map[string]interface{}{"facility": 3, "client": "192.168.1.1:514"}, "an error", false},
+		{map[string]interface{}{"facility": 3, "client": "10.1.2.3:514"}, "all good", false},
+		{map[string]interface{}{"client": "10.1.2.3:514"}, "an error", false},
+	}
+
+	for _, test := range tests {
+		if matches := rt.matches(test.logParts, test.message); matches != test.expected {
+			t.Errorf("rt.matches(%v, %q) got %v; expected %v", test.logParts, test.message, matches, test.expected)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	log "github.com/sirupsen/logrus"
+	"net"
+)
+
+// tcpServer accepts syslog messages on a TCP or TLS listener, split into messages using the TCP
+// framing of the listener. Unlike the go-syslog server, open connections are tracked so that idle
+// clients do not hold up shutdown.
+type tcpServer struct {
+	*streamServer
+	handler *listenerHandler
+	split   bufio.SplitFunc
+}
+
+// startTCPServer listens on the address, over TLS when a TLS config is supplied
+func startTCPServer(l listenerConfig, address string, tlsConfig *tls.Config, handler *listenerHandler) (*tcpServer, error) {
+	framedFormat, err := newFramedFormat(l.Framing, l.FrameDelimiter)
+	if err != nil {
+		return nil, err
+	}
+
+	var listener net.Listener
+	if tlsConfig != nil {
+		listener, err = tls.Listen("tcp", address, tlsConfig)
+	} else {
+		listener, err = net.Listen("tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &tcpServer{handler: handler, split: framedFormat.GetSplitFunc()}
+	s.streamServer = startStreamServer(listener, s.serve)
+
+	return s, nil
+}
+
+// serve reads the messages of the connection
+func (s *tcpServer) serve(conn net.Conn) {
+	tlsPeer := ""
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		// Handshake now so we get the TLS peer information
+		if err := tlsConn.Handshake(); err != nil {
+			if !s.isClosing() {
+				log.Warnf("TLS handshake with %s failed: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		tlsPeer = tlsPeerSubject(tlsConn)
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Split(s.split)
+
+	for scanner.Scan() {
+		handleSocketMessage(s.handler, scanner.Bytes(), conn.RemoteAddr(), tlsPeer, nil)
+	}
+
+	if err := scanner.Err(); err != nil && !s.isClosing() {
+		log.Warnf("closing connection from %s: %v", conn.RemoteAddr(), err)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"gopkg.in/mcuadros/go-syslog.v2"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestShutdownWithIdleTCPConnection(t *testing.T) {
+	channel := make(syslog.LogPartsChannel)
+	server, err := startListener(listenerConfig{IP: "127.0.0.1", Protocol: "tcp", Framing: "newline"}, "tcp", channel)
+	if err != nil {
+		t.Fatalf("failed to start TCP listener: %v", err)
+	}
+
+	// Send one message and leave the connection open
+	conn, err := net.Dial("tcp", server.(*tcpServer).listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("<13>Oct 17 16:21:09 host app: hello\n")); err != nil {
+		t.Fatalf("failed to write message: %v", err)
+	}
+
+	// Stand in for the event loop
+	received := make(chan map[string]interface{}, 1)
+	quit := make(chan bool)
+	finished := make(chan bool)
+	go func() {
+		for {
+			select {
+			case logParts := <-channel:
+				received <- logParts
+			case <-quit:
+				close(finished)
+				return
+			}
+		}
+	}()
+
+	select {
+	case logParts := <-received:
+		if logParts["content"] != "hello" || logParts["hostname"] != "host" {
+			t.Errorf("TCP listener got %v; expected the message", logParts)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TCP listener failed to hand off the message")
+	}
+
+	start := time.Now()
+	if !shutdown([]listenerServer{server}, quit, finished, 5*time.Second) {
+		t.Errorf("shutdown failed to finish the final batch with an idle connection open")
+	}
+
+	if elapsed := time.Since(start); elapsed > shutdownGrace+time.Second {
+		t.Errorf("shutdown took %v with an idle connection open; expected the connection to be stopped", elapsed)
+	}
+}
+
+func TestShutdownFlushBudget(t *testing.T) {
+	// A listener that never stops must not use up the time to ship the final batch
+	quit := make(chan bool)
+	finished := make(chan bool)
+	go func() {
+		<-quit
+		time.Sleep(100 * time.Millisecond)
+		close(finished)
+	}()
+
+	if !shutdown([]listenerServer{stuckServer{}}, quit, finished, 200*time.Millisecond) {
+		t.Errorf("shutdown failed to give the final batch its own deadline")
+	}
+}
+
+// stuckServer is a listener that never stops
+type stuckServer struct{}
+
+func (stuckServer) Kill() error { return nil }
+
+func (stuckServer) Wait() { select {} }
+
+func TestKillFinishesMessageInProgress(t *testing.T) {
+	channel := make(syslog.LogPartsChannel, 1)
+	server, err := startListener(listenerConfig{IP: "127.0.0.1", Protocol: "tcp", Framing: "newline"}, "tcp", channel)
+	if err != nil {
+		t.Fatalf("failed to start TCP listener: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", server.(*tcpServer).listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// Start a message, and finish it after the server is killed but within the grace period
+	if _, err := conn.Write([]byte("<13>Oct 17 16:21:09 host app: hel")); err != nil {
+		t.Fatalf("failed to write message: %v", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	if err := server.Kill(); err != nil {
+		t.Fatalf("failed to kill TCP listener: %v", err)
+	}
+
+	if _, err := conn.Write([]byte("lo\n")); err != nil {
+		t.Fatalf("failed to write message: %v", err)
+	}
+
+	server.Wait()
+
+	select {
+	case logParts := <-channel:
+		if logParts["content"] != "hello" {
+			t.Errorf("TCP listener got %v; expected the message in progress", logParts)
+		}
+	default:
+		t.Errorf("TCP listener dropped the message in progress")
+	}
+}
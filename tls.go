@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"os"
+)
+
+// setupTLSConfig builds the TLS configuration for the syslog listener from the supplied
+// certificate, key and optional CA bundle. When client auth is enabled, peers must present
+// a certificate signed by the CA bundle.
+func setupTLSConfig() (*tls.Config, error) {
+	// Load server certificate and key
+	cert, err := tls.LoadX509KeyPair(viper.GetString("tls-cert"), viper.GetString("tls-key"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to load tls certificate: %v", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		ClientAuth:   tls.NoClientCert,
+	}
+
+	// Load CA bundle used to verify client certificates
+	if viper.GetString("tls-ca") != "" {
+		caPem, err := ioutil.ReadFile(viper.GetString("tls-ca"))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read tls ca file: %v", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPem) {
+			return nil, errors.New("unable to parse certificates in tls ca file")
+		}
+
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	// Require client certificates
+	if viper.GetBool("tls-client-auth") {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// tlsPeerSubject returns the subject of the verified peer certificate for the TLS connection, or
+// an empty string when the client did not present one (the handshake will already have rejected
+// such clients when client auth is required)
+func tlsPeerSubject(tlsConn *tls.Conn) string {
+	state := tlsConn.ConnectionState()
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return state.VerifiedChains[0][0].Subject.String()
+}
+
+// checkTLSParams validates the TLS related params. Only called when a listener uses the tls protocol.
+func checkTLSParams() error {
+	if !fileExists(viper.GetString("tls-cert")) {
+		return errors.New("invalid tls-cert param (--tls-cert)")
+	}
+
+	if !fileExists(viper.GetString("tls-key")) {
+		return errors.New("invalid tls-key param (--tls-key)")
+	}
+
+	if viper.GetString("tls-ca") != "" && !fileExists(viper.GetString("tls-ca")) {
+		return errors.New("invalid tls-ca param (--tls-ca)")
+	}
+
+	if viper.GetBool("tls-client-auth") && viper.GetString("tls-ca") == "" {
+		return errors.New("tls-client-auth requires a CA bundle (--tls-ca)")
+	}
+
+	return nil
+}
+
+func fileExists(filename string) bool {
+	info, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		return false
+	}
+	return err == nil && !info.IsDir()
+}
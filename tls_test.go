@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCertificate writes a self-signed certificate and its key for the common name to the
+// directory. Returns the certificate and key paths.
+func writeTestCertificate(t *testing.T, dir string, commonName string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	certPath := filepath.Join(dir, commonName+".crt")
+	keyPath := filepath.Join(dir, commonName+".key")
+
+	if err := ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+
+	if err := ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	return certPath, keyPath
+}
+
+func TestCheckTLSParams(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	dir, err := ioutil.TempDir("", "syslog-collector")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cert, key := writeTestCertificate(t, dir, "server")
+	ca, _ := writeTestCertificate(t, dir, "ca")
+	missing := filepath.Join(dir, "missing.pem")
+
+	tests := []struct {
+		name       string
+		cert       string
+		key        string
+		ca         string
+		clientAuth bool
+		valid      bool
+	}{
+		{"cert and key", cert, key, "", false, true},
+		{"missing cert", "", key, "", false, false},
+		{"missing cert file", missing, key, "", false, false},
+		{"missing key", cert, "", "", false, false},
+		{"missing key file", cert, missing, "", false, false},
+		{"missing ca file", cert, key, missing, false, false},
+		{"client auth without ca", cert, key, "", true, false},
+		{"client auth with ca", cert, key, ca, true, true},
+	}
+
+	for _, test := range tests {
+		viper.Set("tls-cert", test.cert)
+		viper.Set("tls-key", test.key)
+		viper.Set("tls-ca", test.ca)
+		viper.Set("tls-client-auth", test.clientAuth)
+
+		if err := checkTLSParams(); test.valid && err != nil {
+			t.Errorf("checkTLSParams() with %s failed: %v", test.name, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("checkTLSParams() with %s failed to error", test.name)
+		}
+	}
+}
+
+func TestSetupTLSConfig(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	dir, err := ioutil.TempDir("", "syslog-collector")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cert, key := writeTestCertificate(t, dir, "server")
+	ca, _ := writeTestCertificate(t, dir, "ca")
+
+	tests := []struct {
+		name       string
+		ca         string
+		clientAuth bool
+		expected   tls.ClientAuthType
+	}{
+		{"no ca", "", false, tls.NoClientCert},
+		{"ca only", ca, false, tls.VerifyClientCertIfGiven},
+		{"client auth", ca, true, tls.RequireAndVerifyClientCert},
+	}
+
+	viper.Set("tls-cert", cert)
+	viper.Set("tls-key", key)
+
+	for _, test := range tests {
+		viper.Set("tls-ca", test.ca)
+		viper.Set("tls-client-auth", test.clientAuth)
+
+		tlsConfig, err := setupTLSConfig()
+		if err != nil {
+			t.Errorf("setupTLSConfig() with %s failed: %v", test.name, err)
+			continue
+		}
+
+		if tlsConfig.ClientAuth != test.expected {
+			t.Errorf("setupTLSConfig() with %s got client auth %v; expected %v", test.name, tlsConfig.ClientAuth, test.expected)
+		}
+
+		if (test.ca != "") != (tlsConfig.ClientCAs != nil) {
+			t.Errorf("setupTLSConfig() with %s got client CAs %v; expected them to match the ca param", test.name, tlsConfig.ClientCAs)
+		}
+	}
+
+	// Certificates that cannot be loaded are reported
+	viper.Set("tls-key", ca)
+
+	if _, err := setupTLSConfig(); err == nil {
+		t.Errorf("setupTLSConfig() failed to error on a mismatched key")
+	}
+}
+
+func TestTLSPeerSubject(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	dir, err := ioutil.TempDir("", "syslog-collector")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cert, key := writeTestCertificate(t, dir, "server")
+	clientCert, clientKey := writeTestCertificate(t, dir, "client")
+
+	viper.Set("tls-cert", cert)
+	viper.Set("tls-key", key)
+	viper.Set("tls-ca", clientCert)
+
+	serverConfig, err := setupTLSConfig()
+	if err != nil {
+		t.Fatalf("failed to setup TLS config: %v", err)
+	}
+
+	client, err := tls.LoadX509KeyPair(clientCert, clientKey)
+	if err != nil {
+		t.Fatalf("failed to load client certificate: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		certificates []tls.Certificate
+		expected     string
+	}{
+		{"client certificate", []tls.Certificate{client}, "CN=client"},
+		{"no client certificate", nil, ""},
+	}
+
+	for _, test := range tests {
+		serverConn, clientConn := net.Pipe()
+		server := tls.Server(serverConn, serverConfig)
+
+		go func() {
+			conn := tls.Client(clientConn, &tls.Config{Certificates: test.certificates, InsecureSkipVerify: true})
+			_ = conn.Handshake()
+		}()
+
+		if err := server.Handshake(); err != nil {
+			t.Errorf("handshake with %s failed: %v", test.name, err)
+		} else if subject := tlsPeerSubject(server); subject != test.expected {
+			t.Errorf("tlsPeerSubject() with %s got %q; expected %q", test.name, subject, test.expected)
+		}
+
+		serverConn.Close()
+		clientConn.Close()
+	}
+}
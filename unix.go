@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// peerCredentials identify the process that wrote to a unix socket
+type peerCredentials struct {
+	pid int
+	uid int
+	gid int
+}
+
+// unixServer accepts syslog messages on a unix stream socket, split into messages using the TCP
+// framing of the listener
+type unixServer struct {
+	*streamServer
+	handler *listenerHandler
+	split   bufio.SplitFunc
+}
+
+// unixgramServer receives syslog messages on a unix datagram socket, one message per datagram
+type unixgramServer struct {
+	conn    *net.UnixConn
+	path    string
+	handler *listenerHandler
+	lock    sync.Mutex
+	closing bool
+	wait    sync.WaitGroup
+}
+
+// parseSocketMode parses the octal file mode of a socket path
+func parseSocketMode(value string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid socket mode %s", value)
+	}
+
+	return os.FileMode(mode), nil
+}
+
+// prepareSocketPath removes a stale socket left at the path by a previous run. Anything other
+// than a socket is left alone.
+func prepareSocketPath(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	return os.Remove(path)
+}
+
+// startUnixServer listens on the unix stream socket at the path
+func startUnixServer(l listenerConfig, handler *listenerHandler) (*unixServer, error) {
+	framedFormat, err := newFramedFormat(l.Framing, l.FrameDelimiter)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := prepareSocketPath(l.SocketPath); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", l.SocketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := chmodSocket(l); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	s := &unixServer{handler: handler, split: framedFormat.GetSplitFunc()}
+	s.streamServer = startStreamServer(listener, s.serve)
+
+	return s, nil
+}
+
+// serve reads the messages of the connection
+func (s *unixServer) serve(conn net.Conn) {
+	var credentials *peerCredentials
+	if unixConn, ok := conn.(*net.UnixConn); ok {
+		credentials = streamPeerCredentials(unixConn)
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Split(s.split)
+
+	for scanner.Scan() {
+		handleSocketMessage(s.handler, scanner.Bytes(), conn.RemoteAddr(), "", credentials)
+	}
+
+	if err := scanner.Err(); err != nil && !s.isClosing() {
+		log.Warnf("closing unix socket connection: %v", err)
+	}
+}
+
+// startUnixgramServer listens on the unix datagram socket at the path
+func startUnixgramServer(l listenerConfig, handler *listenerHandler) (*unixgramServer, error) {
+	if err := prepareSocketPath(l.SocketPath); err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: l.SocketPath, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := chmodSocket(l); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// Ask for the credentials of the sender of each datagram
+	if err := enablePeerCredentials(conn); err != nil {
+		log.Warnf("unable to enable peer credentials on %s: %v", l.SocketPath, err)
+	}
+
+	s := &unixgramServer{conn: conn, path: l.SocketPath, handler: handler}
+
+	s.wait.Add(1)
+	go s.receive()
+
+	return s, nil
+}
+
+// Kill closes the socket and removes the socket path
+func (s *unixgramServer) Kill() error {
+	s.lock.Lock()
+	s.closing = true
+	s.lock.Unlock()
+
+	if err := s.conn.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(s.path)
+}
+
+// Wait until the last datagram is handled
+func (s *unixgramServer) Wait() {
+	s.wait.Wait()
+}
+
+func (s *unixgramServer) isClosing() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.closing
+}
+
+func (s *unixgramServer) receive() {
+	defer s.wait.Done()
+
+	buf := make([]byte, maxFrameSize)
+	oob := make([]byte, peerCredentialsSize)
+
+	for {
+		n, oobn, _, addr, err := s.conn.ReadMsgUnix(buf, oob)
+
+		// Handle errors
+		if err != nil {
+			if s.isClosing() {
+				return
+			}
+			log.Errorf("unable to read from unix socket %s: %v", s.path, err)
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+
+		// Ignore trailing control characters and NULs
+		for n > 0 && buf[n-1] < 32 {
+			n--
+		}
+
+		// Unbound senders have no address
+		var client net.Addr
+		if addr != nil {
+			client = addr
+		}
+
+		if n > 0 {
+			handleSocketMessage(s.handler, buf[:n], client, "", datagramPeerCredentials(oob[:oobn]))
+		}
+	}
+}
+
+// chmodSocket sets the file mode of the socket path of the listener
+func chmodSocket(l listenerConfig) error {
+	mode, err := parseSocketMode(l.SocketMode)
+	if err != nil {
+		return err
+	}
+
+	return os.Chmod(l.SocketPath, mode)
+}
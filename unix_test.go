@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSocketMode(t *testing.T) {
+	tests := map[string]os.FileMode{
+		"0666": 0666,
+		"660":  0660,
+		"0600": 0600,
+		"0":    0,
+		"0777": 0777,
+	}
+
+	for value, expected := range tests {
+		if mode, err := parseSocketMode(value); err != nil {
+			t.Errorf("parseSocketMode(%q) failed: %v", value, err)
+		} else if mode != expected {
+			t.Errorf("parseSocketMode(%q) got %o; expected %o", value, mode, expected)
+		}
+	}
+
+	for _, value := range []string{"", "999", "0o666", "rw-rw-rw-", "01777", "-1"} {
+		if _, err := parseSocketMode(value); err == nil {
+			t.Errorf("parseSocketMode(%q) failed to error on invalid mode", value)
+		}
+	}
+}
+
+func TestPrepareSocketPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syslog-collector")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Missing paths are left alone
+	missing := filepath.Join(dir, "missing.sock")
+	if err := prepareSocketPath(missing); err != nil {
+		t.Errorf("prepareSocketPath on missing path failed: %v", err)
+	}
+
+	// Stale sockets are removed
+	stale := filepath.Join(dir, "stale.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: stale, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unix datagram sockets not supported: %v", err)
+	}
+	conn.Close()
+
+	if err := prepareSocketPath(stale); err != nil {
+		t.Errorf("prepareSocketPath on stale socket failed: %v", err)
+	}
+
+	if _, err := os.Lstat(stale); !os.IsNotExist(err) {
+		t.Errorf("prepareSocketPath failed to remove stale socket")
+	}
+
+	// Other files are kept
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, []byte("keep"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	if err := prepareSocketPath(file); err == nil {
+		t.Errorf("prepareSocketPath failed to error on a regular file")
+	}
+
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("prepareSocketPath removed a regular file")
+	}
+
+	if err := prepareSocketPath(dir); err == nil {
+		t.Errorf("prepareSocketPath failed to error on a directory")
+	}
+}